@@ -0,0 +1,44 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+// APIKeyPrefix starts every API key so leaked keys are easy to recognise
+const APIKeyPrefix = "rpk_"
+
+// NewAPIKey returns a random API key of the form "rpk_<id>.<secret>", its
+// public prefix "rpk_<id>" used to look the key up, and the hash to store
+func NewAPIKey() (key, prefix, hash string, err error) {
+	id := make([]byte, 6)
+	if _, err = rand.Read(id); err != nil {
+		return "", "", "", err
+	}
+	secret := make([]byte, 32)
+	if _, err = rand.Read(secret); err != nil {
+		return "", "", "", err
+	}
+
+	prefix = APIKeyPrefix + hex.EncodeToString(id)
+	key = prefix + "." + base64.RawURLEncoding.EncodeToString(secret)
+	return key, prefix, HashAPIKey(key), nil
+}
+
+// SplitAPIKey returns the public prefix of key, or false if key is malformed
+func SplitAPIKey(key string) (string, bool) {
+	prefix, secret, ok := strings.Cut(key, ".")
+	if !ok || !strings.HasPrefix(prefix, APIKeyPrefix) || secret == "" {
+		return "", false
+	}
+	return prefix, true
+}
+
+// HashAPIKey is the stored form of an API key
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
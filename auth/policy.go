@@ -0,0 +1,41 @@
+package auth
+
+import "payment-server/model"
+
+// Actions guarded by a Policy
+const (
+	ActionConfirmPayment = "payments.confirm"
+	ActionRejectPayment  = "payments.reject"
+	ActionManageAPIKeys  = "api_keys.manage"
+	ActionManageRoles    = "users.manage_roles"
+	ActionVerifyLedger   = "ledger.verify"
+	ActionManageLimits   = "limits.manage"
+	ActionDeposit        = "accounts.deposit"
+)
+
+// Policy maps each action to the roles allowed to perform it. Actions that
+// are not listed are denied to everyone.
+type Policy map[string][]string
+
+// DefaultPolicy is the policy enforced by the API
+var DefaultPolicy = Policy{
+	// Force-confirming or rejecting a payment stands in for the mobile money
+	// provider, so only operators may do it
+	ActionConfirmPayment: {model.RoleOperator},
+	ActionRejectPayment:  {model.RoleOperator},
+	ActionManageAPIKeys:  {model.RoleMerchant},
+	ActionManageRoles:    {model.RoleAdmin},
+	ActionVerifyLedger:   {model.RoleAdmin},
+	ActionManageLimits:   {model.RoleAdmin},
+	ActionDeposit:        {model.RoleAdmin},
+}
+
+// Allows reports whether role may perform action
+func (p Policy) Allows(role, action string) bool {
+	for _, allowed := range p[action] {
+		if allowed == role {
+			return true
+		}
+	}
+	return false
+}
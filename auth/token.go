@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"payment-server/config"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+// Claims are carried by access tokens; Subject is the user ID
+type Claims struct {
+	Role string `json:"role"`
+	jwt.RegisteredClaims
+}
+
+// TokenManager issues and verifies HS256 access tokens and mints the
+// opaque refresh tokens that are stored hashed in the database
+type TokenManager struct {
+	secret     []byte
+	issuer     string
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+}
+
+func NewTokenManager(cfg config.AuthConfig, secret string) *TokenManager {
+	return &TokenManager{
+		secret:     []byte(secret),
+		issuer:     cfg.Issuer,
+		accessTTL:  cfg.AccessTokenTTL.Duration,
+		refreshTTL: cfg.RefreshTokenTTL.Duration,
+	}
+}
+
+// IssueAccessToken returns a signed access token for userID and its expiry.
+// The role is fixed until the token expires.
+func (m *TokenManager) IssueAccessToken(userID, role string) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(m.accessTTL)
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+		Role: role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   userID,
+			Issuer:    m.issuer,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	})
+
+	signed, err := token.SignedString(m.secret)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to sign access token: %v", err)
+	}
+	return signed, expiresAt, nil
+}
+
+// ParseAccessToken verifies signature, issuer and expiry of an access token
+func (m *TokenManager) ParseAccessToken(token string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(token, claims,
+		func(*jwt.Token) (interface{}, error) { return m.secret, nil },
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(m.issuer),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil || claims.Subject == "" {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+// RefreshTokenTTL is how long a refresh token stays usable
+func (m *TokenManager) RefreshTokenTTL() time.Duration {
+	return m.refreshTTL
+}
+
+// NewRefreshToken returns a random refresh token and the hash to store
+func NewRefreshToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, HashRefreshToken(token), nil
+}
+
+// HashRefreshToken is the lookup key of a refresh token in storage
+func HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewSecret generates a random secret suitable for signing access tokens
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,466 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds every setting the server needs at startup. Values are
+// resolved from defaults, then the optional CONFIG_FILE, then env vars.
+type Config struct {
+	Server    ServerConfig    `json:"server" yaml:"server"`
+	Database  DatabaseConfig  `json:"database" yaml:"database"`
+	Payments  PaymentsConfig  `json:"payments" yaml:"payments"`
+	Webhooks  WebhooksConfig  `json:"webhooks" yaml:"webhooks"`
+	Auth      AuthConfig      `json:"auth" yaml:"auth"`
+	Providers ProvidersConfig `json:"providers" yaml:"providers"`
+	CORS      CORSConfig      `json:"cors" yaml:"cors"`
+}
+
+type ServerConfig struct {
+	Port            string   `json:"port" yaml:"port"`
+	PublicBaseURL   string   `json:"public_base_url" yaml:"public_base_url"`
+	ReadTimeout     Duration `json:"read_timeout" yaml:"read_timeout"`
+	WriteTimeout    Duration `json:"write_timeout" yaml:"write_timeout"`
+	IdleTimeout     Duration `json:"idle_timeout" yaml:"idle_timeout"`
+	ShutdownTimeout Duration `json:"shutdown_timeout" yaml:"shutdown_timeout"`
+}
+
+type DatabaseConfig struct {
+	// Driver selects the storage backend: "postgres" or "memory"
+	Driver          string   `json:"driver" yaml:"driver"`
+	URL             string   `json:"url" yaml:"url"`
+	Host            string   `json:"host" yaml:"host"`
+	Port            string   `json:"port" yaml:"port"`
+	User            string   `json:"user" yaml:"user"`
+	Password        string   `json:"password" yaml:"password"`
+	Name            string   `json:"name" yaml:"name"`
+	SSLMode         string   `json:"sslmode" yaml:"sslmode"`
+	MaxOpenConns    int      `json:"max_open_conns" yaml:"max_open_conns"`
+	MaxIdleConns    int      `json:"max_idle_conns" yaml:"max_idle_conns"`
+	ConnMaxLifetime Duration `json:"conn_max_lifetime" yaml:"conn_max_lifetime"`
+}
+
+type PaymentsConfig struct {
+	TransactionExpiry Duration `json:"transaction_expiry" yaml:"transaction_expiry"`
+	// IdempotencyKeyTTL is how long an Idempotency-Key can be replayed
+	IdempotencyKeyTTL Duration `json:"idempotency_key_ttl" yaml:"idempotency_key_ttl"`
+	// ExpirySweepInterval is how often stale pending transactions are expired
+	ExpirySweepInterval Duration `json:"expiry_sweep_interval" yaml:"expiry_sweep_interval"`
+}
+
+type WebhooksConfig struct {
+	// DispatchInterval is how often the outbox is polled for due events
+	DispatchInterval Duration `json:"dispatch_interval" yaml:"dispatch_interval"`
+	Timeout          Duration `json:"timeout" yaml:"timeout"`
+	// MaxAttempts is the number of deliveries before an event is dead-lettered
+	MaxAttempts    int      `json:"max_attempts" yaml:"max_attempts"`
+	InitialBackoff Duration `json:"initial_backoff" yaml:"initial_backoff"`
+	MaxBackoff     Duration `json:"max_backoff" yaml:"max_backoff"`
+	// SigningSecret was shared by merchants without their own secret. Every
+	// merchant has one now, and a configured value fails validation so that
+	// deployments still relying on it do not start.
+	SigningSecret string `json:"signing_secret" yaml:"signing_secret"`
+	// SecretRotationGrace is how long a rotated-out secret keeps signing
+	SecretRotationGrace Duration `json:"secret_rotation_grace" yaml:"secret_rotation_grace"`
+}
+
+type AuthConfig struct {
+	// JWTSecret signs access tokens; a temporary one is generated when empty
+	JWTSecret       string   `json:"jwt_secret" yaml:"jwt_secret"`
+	Issuer          string   `json:"issuer" yaml:"issuer"`
+	AccessTokenTTL  Duration `json:"access_token_ttl" yaml:"access_token_ttl"`
+	RefreshTokenTTL Duration `json:"refresh_token_ttl" yaml:"refresh_token_ttl"`
+	// AdminUserIDs are existing users promoted to admin at startup, which
+	// is how the first admin is appointed
+	AdminUserIDs []string `json:"admin_user_ids" yaml:"admin_user_ids"`
+}
+
+type ProvidersConfig struct {
+	// Default collects payments whose payer phone matches no route
+	Default string `json:"default" yaml:"default"`
+	// Routes maps a payer phone prefix such as "+221" to a provider code
+	Routes map[string]string `json:"routes" yaml:"routes"`
+	// CallbackSecrets maps a provider code to the secret its callbacks are
+	// signed with
+	CallbackSecrets map[string]string `json:"callback_secrets" yaml:"callback_secrets"`
+	// ReconcileInterval is how often providers are polled for payments
+	// whose callback has not arrived after ReconcileAfter
+	ReconcileInterval Duration `json:"reconcile_interval" yaml:"reconcile_interval"`
+	ReconcileAfter    Duration `json:"reconcile_after" yaml:"reconcile_after"`
+	// Backoff between status queries for the same payment
+	ReconcileInitialBackoff Duration `json:"reconcile_initial_backoff" yaml:"reconcile_initial_backoff"`
+	ReconcileMaxBackoff     Duration `json:"reconcile_max_backoff" yaml:"reconcile_max_backoff"`
+}
+
+type CORSConfig struct {
+	AllowedOrigins []string `json:"allowed_origins" yaml:"allowed_origins"`
+}
+
+// Duration is a time.Duration that decodes from strings such as "15m"
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// DSN returns the Postgres connection string. URL wins over the
+// individual connection fields when both are set.
+func (c DatabaseConfig) DSN() string {
+	if c.URL != "" {
+		return c.URL
+	}
+	return fmt.Sprintf(
+		"host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
+		c.Host, c.Port, c.User, c.Password, c.Name, c.SSLMode,
+	)
+}
+
+// Default returns the configuration used when nothing else is provided
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Port:            "8082",
+			PublicBaseURL:   "http://localhost:8082",
+			ReadTimeout:     Duration{10 * time.Second},
+			WriteTimeout:    Duration{30 * time.Second},
+			IdleTimeout:     Duration{120 * time.Second},
+			ShutdownTimeout: Duration{15 * time.Second},
+		},
+		Database: DatabaseConfig{
+			Driver:          "postgres",
+			Port:            "5432",
+			SSLMode:         "require",
+			MaxOpenConns:    25,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: Duration{5 * time.Minute},
+		},
+		Payments: PaymentsConfig{
+			TransactionExpiry:   Duration{15 * time.Minute},
+			IdempotencyKeyTTL:   Duration{24 * time.Hour},
+			ExpirySweepInterval: Duration{time.Minute},
+		},
+		Webhooks: WebhooksConfig{
+			DispatchInterval:    Duration{5 * time.Second},
+			Timeout:             Duration{10 * time.Second},
+			MaxAttempts:         10,
+			InitialBackoff:      Duration{30 * time.Second},
+			MaxBackoff:          Duration{6 * time.Hour},
+			SecretRotationGrace: Duration{24 * time.Hour},
+		},
+		Auth: AuthConfig{
+			Issuer:          "realpay",
+			AccessTokenTTL:  Duration{15 * time.Minute},
+			RefreshTokenTTL: Duration{30 * 24 * time.Hour},
+		},
+		Providers: ProvidersConfig{
+			Default:                 "simulator",
+			ReconcileInterval:       Duration{30 * time.Second},
+			ReconcileAfter:          Duration{2 * time.Minute},
+			ReconcileInitialBackoff: Duration{30 * time.Second},
+			ReconcileMaxBackoff:     Duration{10 * time.Minute},
+		},
+		CORS: CORSConfig{
+			AllowedOrigins: []string{"*"},
+		},
+	}
+}
+
+// Load builds the configuration from defaults, the file named by
+// CONFIG_FILE (YAML or JSON) and environment variables, then validates it.
+func Load() (*Config, error) {
+	cfg := Default()
+
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cfg.loadEnv(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, c)
+	case ".json":
+		err = json.Unmarshal(data, c)
+	default:
+		return fmt.Errorf("unsupported config file extension %q (use .yaml, .yml or .json)", filepath.Ext(path))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse config file %s: %v", path, err)
+	}
+	return nil
+}
+
+func (c *Config) loadEnv() error {
+	var errs []error
+
+	setString(&c.Server.Port, "PORT")
+	setString(&c.Server.PublicBaseURL, "PUBLIC_BASE_URL")
+	errs = append(errs,
+		setDuration(&c.Server.ReadTimeout, "SERVER_READ_TIMEOUT"),
+		setDuration(&c.Server.WriteTimeout, "SERVER_WRITE_TIMEOUT"),
+		setDuration(&c.Server.IdleTimeout, "SERVER_IDLE_TIMEOUT"),
+		setDuration(&c.Server.ShutdownTimeout, "SERVER_SHUTDOWN_TIMEOUT"),
+	)
+
+	setString(&c.Database.Driver, "STORE_DRIVER")
+	setString(&c.Database.URL, "DB_URL")
+	setString(&c.Database.Host, "DB_HOST")
+	setString(&c.Database.Port, "DB_PORT")
+	setString(&c.Database.User, "DB_USER")
+	setString(&c.Database.Password, "DB_PASSWORD")
+	setString(&c.Database.Name, "DB_NAME")
+	setString(&c.Database.SSLMode, "DB_SSLMODE")
+	errs = append(errs,
+		setInt(&c.Database.MaxOpenConns, "DB_MAX_OPEN_CONNS"),
+		setInt(&c.Database.MaxIdleConns, "DB_MAX_IDLE_CONNS"),
+		setDuration(&c.Database.ConnMaxLifetime, "DB_CONN_MAX_LIFETIME"),
+	)
+
+	errs = append(errs,
+		setDuration(&c.Payments.TransactionExpiry, "TRANSACTION_EXPIRY"),
+		setDuration(&c.Payments.IdempotencyKeyTTL, "IDEMPOTENCY_KEY_TTL"),
+		setDuration(&c.Payments.ExpirySweepInterval, "EXPIRY_SWEEP_INTERVAL"),
+	)
+
+	errs = append(errs,
+		setDuration(&c.Webhooks.DispatchInterval, "WEBHOOK_DISPATCH_INTERVAL"),
+		setDuration(&c.Webhooks.Timeout, "WEBHOOK_TIMEOUT"),
+		setInt(&c.Webhooks.MaxAttempts, "WEBHOOK_MAX_ATTEMPTS"),
+		setDuration(&c.Webhooks.InitialBackoff, "WEBHOOK_INITIAL_BACKOFF"),
+		setDuration(&c.Webhooks.MaxBackoff, "WEBHOOK_MAX_BACKOFF"),
+		setDuration(&c.Webhooks.SecretRotationGrace, "WEBHOOK_SECRET_ROTATION_GRACE"),
+	)
+	setString(&c.Webhooks.SigningSecret, "WEBHOOK_SIGNING_SECRET")
+
+	setString(&c.Auth.JWTSecret, "JWT_SECRET")
+	setString(&c.Auth.Issuer, "JWT_ISSUER")
+	setList(&c.Auth.AdminUserIDs, "ADMIN_USER_IDS")
+	errs = append(errs,
+		setDuration(&c.Auth.AccessTokenTTL, "ACCESS_TOKEN_TTL"),
+		setDuration(&c.Auth.RefreshTokenTTL, "REFRESH_TOKEN_TTL"),
+	)
+
+	setString(&c.Providers.Default, "PROVIDER_DEFAULT")
+	errs = append(errs, setMap(&c.Providers.Routes, "PROVIDER_ROUTES"))
+	errs = append(errs, setMap(&c.Providers.CallbackSecrets, "PROVIDER_CALLBACK_SECRETS"))
+	errs = append(errs,
+		setDuration(&c.Providers.ReconcileInterval, "PROVIDER_RECONCILE_INTERVAL"),
+		setDuration(&c.Providers.ReconcileAfter, "PROVIDER_RECONCILE_AFTER"),
+		setDuration(&c.Providers.ReconcileInitialBackoff, "PROVIDER_RECONCILE_INITIAL_BACKOFF"),
+		setDuration(&c.Providers.ReconcileMaxBackoff, "PROVIDER_RECONCILE_MAX_BACKOFF"),
+	)
+
+	setList(&c.CORS.AllowedOrigins, "CORS_ALLOWED_ORIGINS")
+
+	return errors.Join(errs...)
+}
+
+// Validate reports every invalid setting at once
+func (c *Config) Validate() error {
+	var errs []error
+
+	if port, err := strconv.Atoi(c.Server.Port); err != nil || port < 1 || port > 65535 {
+		errs = append(errs, fmt.Errorf("server.port must be a number between 1 and 65535, got %q", c.Server.Port))
+	}
+	if u, err := url.Parse(c.Server.PublicBaseURL); err != nil || u.Scheme == "" || u.Host == "" {
+		errs = append(errs, fmt.Errorf("server.public_base_url must be an absolute URL, got %q", c.Server.PublicBaseURL))
+	}
+	errs = append(errs,
+		positive("server.read_timeout", c.Server.ReadTimeout),
+		positive("server.write_timeout", c.Server.WriteTimeout),
+		positive("server.idle_timeout", c.Server.IdleTimeout),
+		positive("server.shutdown_timeout", c.Server.ShutdownTimeout),
+		positive("payments.transaction_expiry", c.Payments.TransactionExpiry),
+		positive("payments.idempotency_key_ttl", c.Payments.IdempotencyKeyTTL),
+		positive("payments.expiry_sweep_interval", c.Payments.ExpirySweepInterval),
+		positive("webhooks.dispatch_interval", c.Webhooks.DispatchInterval),
+		positive("webhooks.timeout", c.Webhooks.Timeout),
+		positive("webhooks.initial_backoff", c.Webhooks.InitialBackoff),
+		positive("webhooks.max_backoff", c.Webhooks.MaxBackoff),
+		positive("webhooks.secret_rotation_grace", c.Webhooks.SecretRotationGrace),
+		positive("providers.reconcile_interval", c.Providers.ReconcileInterval),
+		positive("providers.reconcile_after", c.Providers.ReconcileAfter),
+		positive("providers.reconcile_initial_backoff", c.Providers.ReconcileInitialBackoff),
+		positive("providers.reconcile_max_backoff", c.Providers.ReconcileMaxBackoff),
+	)
+	if c.Webhooks.SigningSecret != "" {
+		errs = append(errs, fmt.Errorf("webhooks.signing_secret is no longer supported, every merchant has its own secret"))
+	}
+	if c.Webhooks.MaxAttempts < 1 {
+		errs = append(errs, fmt.Errorf("webhooks.max_attempts must be at least 1, got %d", c.Webhooks.MaxAttempts))
+	}
+	if c.Webhooks.MaxBackoff.Duration < c.Webhooks.InitialBackoff.Duration {
+		errs = append(errs, fmt.Errorf("webhooks.max_backoff must not be shorter than webhooks.initial_backoff"))
+	}
+
+	switch c.Database.Driver {
+	case "memory":
+	case "postgres":
+		if c.Database.URL == "" {
+			required := []struct{ field, value string }{
+				{"database.host", c.Database.Host},
+				{"database.port", c.Database.Port},
+				{"database.user", c.Database.User},
+				{"database.name", c.Database.Name},
+			}
+			for _, r := range required {
+				if r.value == "" {
+					errs = append(errs, fmt.Errorf("%s is required when database.url is not set", r.field))
+				}
+			}
+		}
+		if c.Database.MaxOpenConns < 1 {
+			errs = append(errs, fmt.Errorf("database.max_open_conns must be at least 1, got %d", c.Database.MaxOpenConns))
+		}
+		if c.Database.MaxIdleConns < 0 || c.Database.MaxIdleConns > c.Database.MaxOpenConns {
+			errs = append(errs, fmt.Errorf("database.max_idle_conns must be between 0 and max_open_conns, got %d", c.Database.MaxIdleConns))
+		}
+		errs = append(errs, positive("database.conn_max_lifetime", c.Database.ConnMaxLifetime))
+	default:
+		errs = append(errs, fmt.Errorf("database.driver must be \"postgres\" or \"memory\", got %q", c.Database.Driver))
+	}
+
+	errs = append(errs,
+		positive("auth.access_token_ttl", c.Auth.AccessTokenTTL),
+		positive("auth.refresh_token_ttl", c.Auth.RefreshTokenTTL),
+	)
+	if c.Auth.JWTSecret != "" && len(c.Auth.JWTSecret) < 32 {
+		errs = append(errs, fmt.Errorf("auth.jwt_secret must be at least 32 characters"))
+	}
+	if c.Auth.Issuer == "" {
+		errs = append(errs, fmt.Errorf("auth.issuer must not be empty"))
+	}
+	for _, userID := range c.Auth.AdminUserIDs {
+		if _, err := uuid.Parse(userID); err != nil {
+			errs = append(errs, fmt.Errorf("auth.admin_user_ids must contain user IDs, got %q", userID))
+		}
+	}
+
+	for prefix, code := range c.Providers.Routes {
+		if !strings.HasPrefix(prefix, "+") || code == "" {
+			errs = append(errs, fmt.Errorf("providers.routes must map international prefixes such as \"+221\" to provider codes, got %q=%q", prefix, code))
+		}
+	}
+	for code, secret := range c.Providers.CallbackSecrets {
+		if len(secret) < 32 {
+			errs = append(errs, fmt.Errorf("providers.callback_secrets.%s must be at least 32 characters", code))
+		}
+	}
+	if len(c.CORS.AllowedOrigins) == 0 {
+		errs = append(errs, fmt.Errorf("cors.allowed_origins must contain at least one origin"))
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("invalid configuration:\n%v", err)
+	}
+	return nil
+}
+
+func positive(field string, d Duration) error {
+	if d.Duration <= 0 {
+		return fmt.Errorf("%s must be a positive duration, got %s", field, d)
+	}
+	return nil
+}
+
+func setString(dst *string, key string) {
+	if value := os.Getenv(key); value != "" {
+		*dst = value
+	}
+}
+
+func setInt(dst *int, key string) error {
+	value := os.Getenv(key)
+	if value == "" {
+		return nil
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("%s must be an integer, got %q", key, value)
+	}
+	*dst = parsed
+	return nil
+}
+
+func setDuration(dst *Duration, key string) error {
+	value := os.Getenv(key)
+	if value == "" {
+		return nil
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("%s must be a duration such as \"30s\", got %q", key, value)
+	}
+	dst.Duration = parsed
+	return nil
+}
+
+func setList(dst *[]string, key string) {
+	value := os.Getenv(key)
+	if value == "" {
+		return
+	}
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	*dst = items
+}
+
+// setMap reads comma separated key=value pairs
+func setMap(dst *map[string]string, key string) error {
+	value := os.Getenv(key)
+	if value == "" {
+		return nil
+	}
+	items := make(map[string]string)
+	for _, item := range strings.Split(value, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(item), "=")
+		if !ok || k == "" || v == "" {
+			return fmt.Errorf("%s must be a list of key=value pairs, got %q", key, item)
+		}
+		items[k] = v
+	}
+	*dst = items
+	return nil
+}
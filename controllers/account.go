@@ -3,11 +3,21 @@ package controllers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 	"net/http"
+	"payment-server/auth"
+	"payment-server/currency"
+	"payment-server/middleware"
 	"payment-server/model"
+	"payment-server/money"
+	"payment-server/utils"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog/log"
 )
 
 import "payment-server/database"
@@ -17,41 +27,106 @@ type RegisterRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
 	Currency string `json:"currency"`
+	Role     string `json:"role"`
 }
 
-// RegisterResponse represents the registration response
+// RegisterResponse represents the registration response. It never
+// includes the password hash.
 type RegisterResponse struct {
-	ID       string `json:"id"`
+	ID       string          `json:"id"`
+	Username string          `json:"username"`
+	Role     string          `json:"role"`
+	Accounts []model.Account `json:"accounts"`
+	Message  string          `json:"message"`
+}
+
+// LoginRequest represents the login request body
+type LoginRequest struct {
 	Username string `json:"username"`
-	Message  string `json:"message"`
+	Password string `json:"password"`
+}
+
+// RefreshRequest carries the refresh token for /refresh and /logout
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
 }
 
+// TokenResponse is returned by login and refresh
+type TokenResponse struct {
+	Success          bool      `json:"success"`
+	AccessToken      string    `json:"access_token"`
+	TokenType        string    `json:"token_type"`
+	ExpiresIn        int64     `json:"expires_in"`
+	RefreshToken     string    `json:"refresh_token"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
+// UserResponse is the public view of a user
+type UserResponse struct {
+	ID          string     `json:"id"`
+	Username    string     `json:"username"`
+	Role        string     `json:"role"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+var (
+	errInvalidCredentials  = errors.New("invalid username or password")
+	errInvalidRefreshToken = errors.New("invalid or expired refresh token")
+)
+
 // UserService handles user-related business logic
 type UserService struct {
-	db *database.Database
+	db     database.Store
+	tokens *auth.TokenManager
+	// dummyHash is compared against for unknown usernames so that the
+	// response time does not reveal which usernames exist
+	dummyHash []byte
 }
 
-func NewUserService(db *database.Database) *UserService {
-	return &UserService{db: db}
+func NewUserService(db database.Store, tokens *auth.TokenManager) *UserService {
+	dummyHash, _ := bcrypt.GenerateFromPassword([]byte("dummy-password"), bcrypt.DefaultCost)
+	return &UserService{db: db, tokens: tokens, dummyHash: dummyHash}
 }
 
-// Register handles user registration
-func (s *UserService) Register(username, password, currency string) (*model.User, error) {
+// registrationError is a problem with the submitted registration rather
+// than a server failure
+type registrationError string
+
+func (e registrationError) Error() string {
+	return string(e)
+}
+
+// Register creates the user together with a default personal account in
+// the given currency. Both are saved in one transaction. Merchants are also
+// given a webhook signing secret.
+func (s *UserService) Register(ctx context.Context, username, password, currencyCode, role string) (*model.User, error) {
 	// Validate input
 	if len(username) < 3 {
-		return nil, fmt.Errorf("username must be at least 3 characters long")
+		return nil, registrationError("username must be at least 3 characters long")
 	}
 	if len(password) < 6 {
-		return nil, fmt.Errorf("password must be at least 6 characters long")
+		return nil, registrationError("password must be at least 6 characters long")
+	}
+	if !currency.IsSupported(currencyCode) {
+		return nil, registrationError(fmt.Sprintf("unsupported currency: %q", currencyCode))
+	}
+	// Operators and admins are only appointed by an admin
+	if role == "" {
+		role = model.RoleCustomer
+	}
+	if role != model.RoleCustomer && role != model.RoleMerchant {
+		return nil, registrationError("role must be customer or merchant")
 	}
 
-	// Check if username already exists
-	exists, err := s.db.CheckUsernameExists(context.Background(), username)
+	// Check if username already exists; a concurrent registration can still
+	// take it, which CreateUser reports as database.ErrUsernameTaken
+	exists, err := s.db.CheckUsernameExists(ctx, username)
 	if err != nil {
 		return nil, fmt.Errorf("failed to check username existence: %v", err)
 	}
 	if exists {
-		return nil, fmt.Errorf("username already exists")
+		return nil, database.ErrUsernameTaken
 	}
 
 	// Hash password
@@ -61,28 +136,46 @@ func (s *UserService) Register(username, password, currency string) (*model.User
 	}
 
 	// Create user
-	userID := uuid.New().String()
-	accountID := uuid.New().String()
+	now := time.Now()
+	userID := utils.GenerateID()
+	accountID := utils.GenerateID()
 
 	// Create default account for user
 	defaultAccount := model.Account{
-		ID:       accountID,
-		Balance:  0,
-		Status:   "active",
-		Kind:     "personal",
-		UserID:   userID,
-		Currency: currency,
+		ID:        accountID,
+		Balance:   money.Money{Currency: currencyCode},
+		Status:    model.AccountActive,
+		Kind:      model.AccountPersonal,
+		UserID:    userID,
+		Currency:  currencyCode,
+		CreatedAt: now,
+		UpdatedAt: now,
 	}
 
 	user := &model.User{
-		ID:       userID,
-		Username: username,
-		Password: string(hashedPassword),
-		Accounts: []model.Account{defaultAccount},
+		ID:        userID,
+		Username:  username,
+		Password:  string(hashedPassword),
+		Role:      role,
+		Accounts:  []model.Account{defaultAccount},
+		CreatedAt: now,
+		UpdatedAt: now,
 	}
 
-	// Save user (in a real app, this would be in a database)
-	s.db.CreateUser(context.Background(), nil, user)
+	// Save user and default account
+	if err := s.db.CreateUser(ctx, user); err != nil {
+		if errors.Is(err, database.ErrUsernameTaken) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to create user: %v", err)
+	}
+
+	// The merchant can still issue a secret itself by rotating
+	if role == model.RoleMerchant {
+		if err := provisionWebhookSecret(ctx, s.db, userID); err != nil {
+			log.Error().Err(err).Str("userID", userID).Msg("Failed to provision webhook secret")
+		}
+	}
 
 	return user, nil
 }
@@ -90,21 +183,25 @@ func (s *UserService) Register(username, password, currency string) (*model.User
 // RegisterHandler handles HTTP registration requests
 func RegisterHandler(service *UserService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-			return
-		}
-
 		var req RegisterRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			utils.SendError(w, "Invalid request body", http.StatusBadRequest)
 			return
 		}
 
 		// Register user
-		user, err := service.Register(req.Username, req.Password, req.Currency)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+		user, err := service.Register(r.Context(), req.Username, req.Password, req.Currency, req.Role)
+		var invalid registrationError
+		switch {
+		case errors.As(err, &invalid):
+			utils.SendError(w, err.Error(), http.StatusBadRequest)
+			return
+		case errors.Is(err, database.ErrUsernameTaken):
+			utils.SendError(w, "username already exists", http.StatusConflict)
+			return
+		case err != nil:
+			log.Error().Err(err).Msg("Registration failed")
+			utils.SendError(w, "Failed to register user", http.StatusInternalServerError)
 			return
 		}
 
@@ -112,12 +209,413 @@ func RegisterHandler(service *UserService) http.HandlerFunc {
 		resp := RegisterResponse{
 			ID:       user.ID,
 			Username: user.Username,
+			Role:     user.Role,
+			Accounts: user.Accounts,
 			Message:  "Registration successful",
 		}
 
 		// Send response
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusCreated)
-		json.NewEncoder(w).Encode(resp)
+		utils.SendSuccess(w, resp, http.StatusCreated)
+	}
+}
+
+// Login checks the password and starts a new refresh token family
+func (s *UserService) Login(ctx context.Context, username, password string) (*TokenResponse, error) {
+	user, err := s.db.GetUserByUsername(ctx, username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load user: %v", err)
+	}
+	if user == nil {
+		bcrypt.CompareHashAndPassword(s.dummyHash, []byte(password))
+		return nil, errInvalidCredentials
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		return nil, errInvalidCredentials
+	}
+
+	now := time.Now()
+	refresh, tokens, err := s.issueTokens(user, utils.GenerateID(), now)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.CreateRefreshToken(ctx, refresh); err != nil {
+		return nil, fmt.Errorf("failed to save refresh token: %v", err)
+	}
+	if err := s.db.UpdateLastLogin(ctx, user.ID, now); err != nil {
+		return nil, fmt.Errorf("failed to update last login: %v", err)
+	}
+	return tokens, nil
+}
+
+// Refresh exchanges a refresh token for a new access and refresh token.
+// Presenting a token that was already exchanged revokes its whole family,
+// since either the client or an attacker holds a stolen copy.
+func (s *UserService) Refresh(ctx context.Context, token string) (*TokenResponse, error) {
+	current, err := s.db.GetRefreshToken(ctx, auth.HashRefreshToken(token))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load refresh token: %v", err)
+	}
+	if current == nil {
+		return nil, errInvalidRefreshToken
+	}
+
+	now := time.Now()
+	if current.RevokedAt != nil {
+		s.revokeReusedFamily(ctx, current, now)
+		return nil, errInvalidRefreshToken
+	}
+	if !current.Active(now) {
+		return nil, errInvalidRefreshToken
+	}
+
+	// Reload the user so that role changes apply from the next access token
+	user, err := s.db.GetUserByID(ctx, current.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load user: %v", err)
+	}
+	if user == nil {
+		return nil, errInvalidRefreshToken
+	}
+
+	next, tokens, err := s.issueTokens(user, current.FamilyID, now)
+	if err != nil {
+		return nil, err
+	}
+	err = s.db.RotateRefreshToken(ctx, current.ID, next)
+	if errors.Is(err, database.ErrRefreshTokenReused) {
+		s.revokeReusedFamily(ctx, current, now)
+		return nil, errInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to rotate refresh token: %v", err)
+	}
+	return tokens, nil
+}
+
+// Logout revokes the refresh token and every token rotated from the same
+// login. Unknown tokens are ignored so that logging out twice succeeds.
+func (s *UserService) Logout(ctx context.Context, token string) error {
+	current, err := s.db.GetRefreshToken(ctx, auth.HashRefreshToken(token))
+	if err != nil {
+		return fmt.Errorf("failed to load refresh token: %v", err)
+	}
+	if current == nil {
+		return nil
+	}
+	if err := s.db.RevokeRefreshTokenFamily(ctx, current.FamilyID, time.Now()); err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %v", err)
+	}
+	return nil
+}
+
+func (s *UserService) issueTokens(user *model.User, familyID string, now time.Time) (*model.RefreshToken, *TokenResponse, error) {
+	accessToken, accessExpiresAt, err := s.tokens.IssueAccessToken(user.ID, user.Role)
+	if err != nil {
+		return nil, nil, err
+	}
+	refreshToken, hash, err := auth.NewRefreshToken()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate refresh token: %v", err)
+	}
+
+	refresh := &model.RefreshToken{
+		ID:        utils.GenerateID(),
+		UserID:    user.ID,
+		TokenHash: hash,
+		FamilyID:  familyID,
+		ExpiresAt: now.Add(s.tokens.RefreshTokenTTL()),
+		CreatedAt: now,
+	}
+	return refresh, &TokenResponse{
+		Success:          true,
+		AccessToken:      accessToken,
+		TokenType:        "Bearer",
+		ExpiresIn:        int64(accessExpiresAt.Sub(now).Seconds()),
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: refresh.ExpiresAt,
+	}, nil
+}
+
+func (s *UserService) revokeReusedFamily(ctx context.Context, token *model.RefreshToken, now time.Time) {
+	log.Warn().
+		Str("userID", token.UserID).
+		Str("familyID", token.FamilyID).
+		Msg("Refresh token reused, revoking token family")
+	if err := s.db.RevokeRefreshTokenFamily(ctx, token.FamilyID, now); err != nil {
+		log.Error().Err(err).Str("familyID", token.FamilyID).Msg("Failed to revoke refresh token family")
+	}
+}
+
+// LoginHandler handles HTTP login requests
+func LoginHandler(service *UserService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req LoginRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			utils.SendError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		tokens, err := service.Login(r.Context(), req.Username, req.Password)
+		if err != nil {
+			sendAuthError(w, err, "Failed to log in")
+			return
+		}
+		utils.SendSuccess(w, tokens, http.StatusOK)
+	}
+}
+
+// RefreshHandler handles HTTP refresh token exchanges
+func RefreshHandler(service *UserService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req RefreshRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+			utils.SendError(w, "refresh_token is required", http.StatusBadRequest)
+			return
+		}
+
+		tokens, err := service.Refresh(r.Context(), req.RefreshToken)
+		if err != nil {
+			sendAuthError(w, err, "Failed to refresh token")
+			return
+		}
+		utils.SendSuccess(w, tokens, http.StatusOK)
+	}
+}
+
+// LogoutHandler handles HTTP logout requests
+func LogoutHandler(service *UserService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req RefreshRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+			utils.SendError(w, "refresh_token is required", http.StatusBadRequest)
+			return
+		}
+
+		if err := service.Logout(r.Context(), req.RefreshToken); err != nil {
+			sendAuthError(w, err, "Failed to log out")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// MeHandler returns the authenticated user
+func MeHandler(service *UserService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := service.db.GetUserByID(r.Context(), middleware.UserID(r.Context()))
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to load user")
+			utils.SendError(w, "Failed to load user", http.StatusInternalServerError)
+			return
+		}
+		if user == nil {
+			utils.SendError(w, "User not found", http.StatusNotFound)
+			return
+		}
+
+		utils.SendSuccess(w, UserResponse{
+			ID:          user.ID,
+			Username:    user.Username,
+			Role:        user.Role,
+			LastLoginAt: user.LastLoginAt,
+			CreatedAt:   user.CreatedAt,
+		}, http.StatusOK)
+	}
+}
+
+func sendAuthError(w http.ResponseWriter, err error, message string) {
+	if errors.Is(err, errInvalidCredentials) || errors.Is(err, errInvalidRefreshToken) {
+		utils.SendError(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	log.Error().Err(err).Msg(message)
+	utils.SendError(w, message, http.StatusInternalServerError)
+}
+
+const (
+	maxAccountNameLength        = 255
+	maxAccountDescriptionLength = 1000
+	maxAccountMetadataSize      = 16 << 10
+)
+
+// AccountController exposes the authenticated user's accounts
+type AccountController struct {
+	db database.Store
+}
+
+func NewAccountController(db database.Store) *AccountController {
+	return &AccountController{db: db}
+}
+
+// ListAccounts lists the user's accounts, filtered by ?status= if given
+func (ac *AccountController) ListAccounts(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status != "" && !model.IsValidAccountStatus(status) {
+		utils.SendError(w, "status must be one of active, suspended, closed, pending_verification", http.StatusBadRequest)
+		return
+	}
+
+	userID := middleware.UserID(r.Context())
+	accounts, err := ac.db.ListAccounts(r.Context(), userID, status)
+	if err != nil {
+		log.Error().Err(err).Str("userID", userID).Msg("Failed to list accounts")
+		utils.SendError(w, "Failed to list accounts", http.StatusInternalServerError)
+		return
+	}
+	utils.SendSuccess(w, model.AccountsResponse{Success: true, Accounts: accounts}, http.StatusOK)
+}
+
+func (ac *AccountController) GetAccount(w http.ResponseWriter, r *http.Request) {
+	account, ok := ac.loadAccount(w, r)
+	if !ok {
+		return
+	}
+	utils.SendSuccess(w, model.AccountResponse{Success: true, Account: *account}, http.StatusOK)
+}
+
+// CreateAccount opens an additional account. A user holds at most one
+// open account of each kind per currency.
+func (ac *AccountController) CreateAccount(w http.ResponseWriter, r *http.Request) {
+	var req model.CreateAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.SendError(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if req.Kind == "" {
+		req.Kind = model.AccountPersonal
+	}
+	if err := validateNewAccount(&req, middleware.Role(r.Context())); err != nil {
+		utils.SendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userID := middleware.UserID(r.Context())
+	existing, err := ac.db.ListAccounts(r.Context(), userID, "")
+	if err != nil {
+		log.Error().Err(err).Str("userID", userID).Msg("Failed to list accounts")
+		utils.SendError(w, "Failed to create account", http.StatusInternalServerError)
+		return
+	}
+	for _, account := range existing {
+		if account.Kind == req.Kind && account.Currency == req.Currency && account.Status != model.AccountClosed {
+			utils.SendError(w, fmt.Sprintf("you already have a %s account in %s", req.Kind, req.Currency), http.StatusConflict)
+			return
+		}
+	}
+
+	now := time.Now()
+	account := &model.Account{
+		ID:          utils.GenerateID(),
+		UserID:      userID,
+		Balance:     money.Money{Currency: req.Currency},
+		Status:      model.AccountActive,
+		Kind:        req.Kind,
+		Currency:    req.Currency,
+		Name:        req.Name,
+		Description: req.Description,
+		Metadata:    req.Metadata,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := ac.db.CreateAccount(r.Context(), account); err != nil {
+		log.Error().Err(err).Str("userID", userID).Msg("Failed to create account")
+		utils.SendError(w, "Failed to create account", http.StatusInternalServerError)
+		return
+	}
+	utils.SendSuccess(w, model.AccountResponse{Success: true, Account: *account}, http.StatusCreated)
+}
+
+// UpdateAccount changes the name, description or metadata of an account
+func (ac *AccountController) UpdateAccount(w http.ResponseWriter, r *http.Request) {
+	var req model.UpdateAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.SendError(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	account, ok := ac.loadAccount(w, r)
+	if !ok {
+		return
+	}
+
+	if req.Name != nil {
+		account.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Description != nil {
+		account.Description = *req.Description
+	}
+	if req.Metadata != nil {
+		account.Metadata = req.Metadata
+		if string(req.Metadata) == "null" {
+			account.Metadata = nil
+		}
+	}
+	if err := validateAccountDetails(account.Name, account.Description, account.Metadata); err != nil {
+		utils.SendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	account.UpdatedAt = time.Now()
+	if err := ac.db.UpdateAccountDetails(r.Context(), account); err != nil {
+		log.Error().Err(err).Str("accountID", account.ID).Msg("Failed to update account")
+		utils.SendError(w, "Failed to update account", http.StatusInternalServerError)
+		return
+	}
+	utils.SendSuccess(w, model.AccountResponse{Success: true, Account: *account}, http.StatusOK)
+}
+
+// loadAccount fetches the {id} account and answers 404 unless it belongs
+// to the authenticated user
+func (ac *AccountController) loadAccount(w http.ResponseWriter, r *http.Request) (*model.Account, bool) {
+	accountID := mux.Vars(r)["id"]
+	account, err := ac.db.GetAccountByID(r.Context(), accountID)
+	if err != nil {
+		log.Error().Err(err).Str("accountID", accountID).Msg("Account retrieval failed")
+		utils.SendError(w, "Failed to retrieve account", http.StatusInternalServerError)
+		return nil, false
+	}
+	if account == nil || account.UserID != middleware.UserID(r.Context()) {
+		utils.SendError(w, "Account not found", http.StatusNotFound)
+		return nil, false
+	}
+	return account, true
+}
+
+func validateNewAccount(req *model.CreateAccountRequest, role string) error {
+	if !currency.IsSupported(req.Currency) {
+		return fmt.Errorf("unsupported currency: %q", req.Currency)
+	}
+	if !model.IsValidAccountKind(req.Kind) {
+		return fmt.Errorf("kind must be one of personal, business, savings, merchant")
+	}
+	if req.Kind == model.AccountMerchant && role != model.RoleMerchant {
+		return fmt.Errorf("only merchants can open merchant accounts")
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if string(req.Metadata) == "null" {
+		req.Metadata = nil
+	}
+	return validateAccountDetails(req.Name, req.Description, req.Metadata)
+}
+
+func validateAccountDetails(name, description string, metadata json.RawMessage) error {
+	if len(name) > maxAccountNameLength {
+		return fmt.Errorf("name must be at most %d characters", maxAccountNameLength)
+	}
+	if len(description) > maxAccountDescriptionLength {
+		return fmt.Errorf("description must be at most %d characters", maxAccountDescriptionLength)
+	}
+	if metadata != nil {
+		if len(metadata) > maxAccountMetadataSize {
+			return fmt.Errorf("metadata must be at most %d bytes", maxAccountMetadataSize)
+		}
+		var object map[string]interface{}
+		if err := json.Unmarshal(metadata, &object); err != nil {
+			return fmt.Errorf("metadata must be a JSON object")
+		}
 	}
+	return nil
 }
@@ -0,0 +1,343 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"payment-server/currency"
+	"payment-server/database"
+	"payment-server/ledger"
+	"payment-server/middleware"
+	"payment-server/model"
+	"payment-server/money"
+	"payment-server/utils"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog/log"
+)
+
+// AdminController exposes user administration, deposits and ledger checks
+// to admins
+type AdminController struct {
+	db     database.Store
+	ledger *ledger.Ledger
+}
+
+func NewAdminController(db database.Store, ledger *ledger.Ledger) *AdminController {
+	return &AdminController{db: db, ledger: ledger}
+}
+
+// LedgerVerifyResponse lists the broken ledger invariants; it is empty
+// when the books balance
+type LedgerVerifyResponse struct {
+	Success    bool               `json:"success"`
+	Balanced   bool               `json:"balanced"`
+	Violations []ledger.Violation `json:"violations"`
+}
+
+// SetUserRole changes a user's role. The change applies to the user's
+// next access token and is written to the audit log.
+func (ac *AdminController) SetUserRole(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["id"]
+
+	var req model.RoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.SendError(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if !model.IsValidRole(req.Role) {
+		utils.SendError(w, "role must be one of customer, merchant, operator, admin", http.StatusBadRequest)
+		return
+	}
+
+	user, err := ac.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		log.Error().Err(err).Str("userID", userID).Msg("Failed to load user")
+		utils.SendError(w, "Failed to update role", http.StatusInternalServerError)
+		return
+	}
+	if user == nil {
+		utils.SendError(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	err = ac.db.UpdateUserRole(r.Context(), userID, req.Role)
+	if errors.Is(err, database.ErrUserNotFound) {
+		utils.SendError(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Str("userID", userID).Msg("Failed to update role")
+		utils.SendError(w, "Failed to update role", http.StatusInternalServerError)
+		return
+	}
+
+	changes, _ := json.Marshal(map[string]string{"old": user.Role, "new": req.Role})
+	entry := &model.AuditLog{
+		ID:         utils.GenerateID(),
+		EntityType: "users",
+		EntityID:   userID,
+		Action:     model.AuditRoleChange,
+		ActorID:    middleware.UserID(r.Context()),
+		ActorType:  "user",
+		Changes:    changes,
+		IPAddress:  middleware.RemoteIP(r),
+		UserAgent:  r.UserAgent(),
+		CreatedAt:  time.Now(),
+	}
+	if err := ac.db.CreateAuditLog(r.Context(), entry); err != nil {
+		log.Error().Err(err).Str("userID", userID).Msg("Failed to record role change")
+	}
+	if req.Role == model.RoleMerchant {
+		if err := provisionWebhookSecret(r.Context(), ac.db, userID); err != nil {
+			log.Error().Err(err).Str("userID", userID).Msg("Failed to provision webhook secret")
+		}
+	}
+
+	user.Role = req.Role
+	utils.SendSuccess(w, UserResponse{
+		ID:          user.ID,
+		Username:    user.Username,
+		Role:        user.Role,
+		LastLoginAt: user.LastLoginAt,
+		CreatedAt:   user.CreatedAt,
+	}, http.StatusOK)
+}
+
+// VerifyLedger runs the ledger invariant checks
+func (ac *AdminController) VerifyLedger(w http.ResponseWriter, r *http.Request) {
+	violations, err := ac.ledger.Verify(r.Context())
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to verify ledger")
+		utils.SendError(w, "Failed to verify ledger", http.StatusInternalServerError)
+		return
+	}
+	if len(violations) > 0 {
+		log.Error().Int("violations", len(violations)).Msg("Ledger invariants violated")
+	}
+
+	utils.SendSuccess(w, LedgerVerifyResponse{
+		Success:    true,
+		Balanced:   len(violations) == 0,
+		Violations: violations,
+	}, http.StatusOK)
+}
+
+// ListLimits returns the limits of every account type and currency
+func (ac *AdminController) ListLimits(w http.ResponseWriter, r *http.Request) {
+	limits, err := ac.db.ListAccountLimits(r.Context())
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list account limits")
+		utils.SendError(w, "Failed to list limits", http.StatusInternalServerError)
+		return
+	}
+
+	utils.SendSuccess(w, model.AccountLimitsResponse{
+		Success: true,
+		Limits:  limits,
+	}, http.StatusOK)
+}
+
+// SetLimits replaces the limits of an account type and currency. They apply
+// to the next transfer of every matching account.
+func (ac *AdminController) SetLimits(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	accountType, currencyCode := vars["type"], vars["currency"]
+	if !model.IsValidAccountKind(accountType) {
+		utils.SendError(w, "type must be one of personal, business, merchant, savings", http.StatusBadRequest)
+		return
+	}
+	if !currency.IsSupported(currencyCode) {
+		utils.SendError(w, "Unsupported currency", http.StatusBadRequest)
+		return
+	}
+
+	var req model.AccountLimitsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.SendError(w, invalidRequestMessage(err), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if err := validateLimits(&req, currencyCode); err != nil {
+		utils.SendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	limits := &model.AccountLimits{
+		ID:                   utils.GenerateID(),
+		AccountType:          accountType,
+		Currency:             currencyCode,
+		SingleTransferLimit:  req.SingleTransferLimit,
+		DailyTransferLimit:   req.DailyTransferLimit,
+		MonthlyTransferLimit: req.MonthlyTransferLimit,
+		MinBalance:           req.MinBalance,
+		MaxBalance:           req.MaxBalance,
+		CreatedAt:            now,
+		UpdatedAt:            now,
+	}
+	if err := ac.db.UpsertAccountLimits(r.Context(), limits); err != nil {
+		log.Error().Err(err).Str("accountType", accountType).Str("currency", currencyCode).Msg("Failed to save account limits")
+		utils.SendError(w, "Failed to update limits", http.StatusInternalServerError)
+		return
+	}
+
+	changes, _ := json.Marshal(limits)
+	entry := &model.AuditLog{
+		ID:         utils.GenerateID(),
+		EntityType: "account_limits",
+		EntityID:   limits.ID,
+		Action:     model.AuditLimitChange,
+		ActorID:    middleware.UserID(r.Context()),
+		ActorType:  "user",
+		Changes:    changes,
+		IPAddress:  middleware.RemoteIP(r),
+		UserAgent:  r.UserAgent(),
+		CreatedAt:  now,
+	}
+	if err := ac.db.CreateAuditLog(r.Context(), entry); err != nil {
+		log.Error().Err(err).Str("limitsID", limits.ID).Msg("Failed to record limit change")
+	}
+
+	utils.SendSuccess(w, limits, http.StatusOK)
+}
+
+// Deposit credits an account from the clearing account of its currency,
+// which is how money enters the ledger. The deposit is a transfer, so the
+// account owner sees it through GET /v1/transfers/{id}.
+func (ac *AdminController) Deposit(w http.ResponseWriter, r *http.Request) {
+	accountID := mux.Vars(r)["id"]
+
+	var req model.DepositRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.SendError(w, invalidRequestMessage(err), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if err := validateDepositRequest(&req); err != nil {
+		utils.SendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	account, err := ac.db.GetAccountByID(r.Context(), accountID)
+	if err != nil {
+		log.Error().Err(err).Str("accountID", accountID).Msg("Account retrieval failed")
+		utils.SendError(w, "Failed to process deposit", http.StatusInternalServerError)
+		return
+	}
+	if account == nil || account.Kind == model.AccountClearing {
+		utils.SendError(w, "Account not found", http.StatusNotFound)
+		return
+	}
+	if req.Amount.Currency != account.Currency {
+		utils.SendError(w, fmt.Sprintf("amount must be in %s, the currency of the account", account.Currency), http.StatusBadRequest)
+		return
+	}
+
+	clearing, err := ac.db.GetClearingAccount(r.Context(), account.Currency)
+	if err != nil {
+		log.Error().Err(err).Str("currency", account.Currency).Msg("Failed to open clearing account")
+		utils.SendError(w, "Failed to process deposit", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	transfer := &model.Transfer{
+		ID:            utils.GenerateID(),
+		FromAccountID: clearing.ID,
+		ToAccountID:   account.ID,
+		Amount:        req.Amount,
+		Status:        model.TransferCompleted,
+		Description:   req.Description,
+		Reference:     req.Reference,
+		ExecutedAt:    &now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	entry := ledger.TransferEntry(transfer.ID, clearing.ID, account.ID, transfer.Amount.Amount, transfer.Amount.Currency, transfer.Description)
+	entry.CreatedAt = now
+	if err := ledger.Prepare(entry); err != nil {
+		utils.SendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if _, err := ac.db.CreateTransfer(r.Context(), transfer, entry); err != nil {
+		log.Error().Err(err).Str("accountID", account.ID).Msg("Deposit failed")
+		sendLedgerError(w, err, transfer.Amount.Currency)
+		return
+	}
+
+	changes, _ := json.Marshal(transfer)
+	audit := &model.AuditLog{
+		ID:         utils.GenerateID(),
+		EntityType: "account",
+		EntityID:   account.ID,
+		Action:     model.AuditDeposit,
+		ActorID:    middleware.UserID(r.Context()),
+		ActorType:  "user",
+		Changes:    changes,
+		IPAddress:  middleware.RemoteIP(r),
+		UserAgent:  r.UserAgent(),
+		CreatedAt:  now,
+	}
+	if err := ac.db.CreateAuditLog(r.Context(), audit); err != nil {
+		log.Error().Err(err).Str("transferID", transfer.ID).Msg("Failed to record deposit")
+	}
+
+	utils.SendSuccess(w, model.TransferResponse{
+		Success:  true,
+		Message:  "Deposit completed successfully",
+		Transfer: *transfer,
+	}, http.StatusCreated)
+}
+
+func validateDepositRequest(req *model.DepositRequest) error {
+	if !currency.IsSupported(req.Amount.Currency) {
+		return fmt.Errorf("unsupported currency: %q", req.Amount.Currency)
+	}
+	if !req.Amount.IsPositive() {
+		return fmt.Errorf("invalid amount: must be positive")
+	}
+	if len(req.Description) > maxTransferDescriptionLength {
+		return fmt.Errorf("description must be at most %d characters", maxTransferDescriptionLength)
+	}
+	if len(req.Reference) > maxTransferReferenceLength {
+		return fmt.Errorf("reference must be at most %d characters", maxTransferReferenceLength)
+	}
+	return nil
+}
+
+// validateLimits checks that the limits are in currencyCode and consistent.
+// min_balance defaults to zero.
+func validateLimits(req *model.AccountLimitsRequest, currencyCode string) error {
+	if req.MinBalance == (money.Money{}) {
+		req.MinBalance.Currency = currencyCode
+	}
+	amounts := []money.Money{req.SingleTransferLimit, req.DailyTransferLimit, req.MonthlyTransferLimit, req.MinBalance}
+	if req.MaxBalance != nil {
+		amounts = append(amounts, *req.MaxBalance)
+	}
+	for _, amount := range amounts {
+		if amount.Currency != currencyCode {
+			return fmt.Errorf("limits must be in %s", currencyCode)
+		}
+	}
+
+	switch {
+	case !req.SingleTransferLimit.IsPositive() || !req.DailyTransferLimit.IsPositive() || !req.MonthlyTransferLimit.IsPositive():
+		return errors.New("transfer limits must be positive")
+	case req.SingleTransferLimit.Amount > req.DailyTransferLimit.Amount:
+		return errors.New("single_transfer_limit must not exceed daily_transfer_limit")
+	case req.DailyTransferLimit.Amount > req.MonthlyTransferLimit.Amount:
+		return errors.New("daily_transfer_limit must not exceed monthly_transfer_limit")
+	case req.MaxBalance != nil && req.MaxBalance.Amount < req.MinBalance.Amount:
+		return errors.New("max_balance must not be below min_balance")
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"payment-server/auth"
+	"payment-server/database"
+	"payment-server/middleware"
+	"payment-server/model"
+	"payment-server/utils"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog/log"
+)
+
+const maxAPIKeyNameLength = 255
+
+// APIKeyController lets a logged-in merchant manage the API keys used to
+// call the payments API
+type APIKeyController struct {
+	db database.Store
+}
+
+func NewAPIKeyController(db database.Store) *APIKeyController {
+	return &APIKeyController{db: db}
+}
+
+// CreateKey issues a new API key and returns it once; only its hash is kept
+func (kc *APIKeyController) CreateKey(w http.ResponseWriter, r *http.Request) {
+	var req model.APIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.SendError(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > maxAPIKeyNameLength {
+		utils.SendError(w, "name is required and must be at most 255 characters", http.StatusBadRequest)
+		return
+	}
+	scopes, err := normalizeScopes(req.Scopes)
+	if err != nil {
+		utils.SendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	value, prefix, hash, err := auth.NewAPIKey()
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to generate API key")
+		utils.SendError(w, "Failed to create API key", http.StatusInternalServerError)
+		return
+	}
+
+	merchantID := middleware.UserID(r.Context())
+	key := &model.APIKey{
+		ID:         utils.GenerateID(),
+		MerchantID: merchantID,
+		Name:       req.Name,
+		Prefix:     prefix,
+		KeyHash:    hash,
+		Scopes:     scopes,
+		CreatedAt:  time.Now(),
+	}
+	if err := kc.db.CreateAPIKey(r.Context(), key); err != nil {
+		log.Error().Err(err).Str("merchantID", merchantID).Msg("Failed to save API key")
+		utils.SendError(w, "Failed to create API key", http.StatusInternalServerError)
+		return
+	}
+
+	key.Key = value
+	utils.SendSuccess(w, model.APIKeysResponse{Success: true, Keys: []model.APIKey{*key}}, http.StatusCreated)
+}
+
+// ListKeys shows the merchant's keys, including revoked ones
+func (kc *APIKeyController) ListKeys(w http.ResponseWriter, r *http.Request) {
+	merchantID := middleware.UserID(r.Context())
+	keys, err := kc.db.ListAPIKeys(r.Context(), merchantID)
+	if err != nil {
+		log.Error().Err(err).Str("merchantID", merchantID).Msg("Failed to list API keys")
+		utils.SendError(w, "Failed to list API keys", http.StatusInternalServerError)
+		return
+	}
+	utils.SendSuccess(w, model.APIKeysResponse{Success: true, Keys: keys}, http.StatusOK)
+}
+
+// RevokeKey stops an API key from authenticating any further requests
+func (kc *APIKeyController) RevokeKey(w http.ResponseWriter, r *http.Request) {
+	merchantID := middleware.UserID(r.Context())
+	keyID := mux.Vars(r)["id"]
+
+	err := kc.db.RevokeAPIKey(r.Context(), merchantID, keyID, time.Now())
+	if errors.Is(err, database.ErrAPIKeyNotFound) {
+		utils.SendError(w, "API key not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Str("merchantID", merchantID).Str("keyID", keyID).Msg("Failed to revoke API key")
+		utils.SendError(w, "Failed to revoke API key", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// normalizeScopes rejects unknown scopes and drops duplicates
+func normalizeScopes(requested []string) ([]string, error) {
+	if len(requested) == 0 {
+		return nil, errors.New("at least one scope is required")
+	}
+	seen := make(map[string]bool)
+	scopes := make([]string, 0, len(requested))
+	for _, scope := range requested {
+		if !model.IsValidScope(scope) {
+			return nil, errors.New("unknown scope: " + scope)
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes, nil
+}
@@ -0,0 +1,230 @@
+package controllers
+
+import (
+	"embed"
+	"html/template"
+	"net/http"
+	"payment-server/config"
+	"payment-server/database"
+	"payment-server/metrics"
+	"payment-server/model"
+	"payment-server/provider"
+	"payment-server/webhook"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog/log"
+)
+
+//go:embed templates/checkout.html
+var templateFiles embed.FS
+
+var checkoutTemplate = template.Must(template.ParseFS(templateFiles, "templates/checkout.html"))
+
+// checkoutRefreshSeconds is how often the page reloads while the payer
+// approves on their phone
+const checkoutRefreshSeconds = 5
+
+// CheckoutController serves the hosted payment page that payers reach
+// through the payment URL returned by InitializePayment
+type CheckoutController struct {
+	cfg       *config.Config
+	db        database.Store
+	providers *provider.Registry
+	sender    *webhook.Sender
+}
+
+func NewCheckoutController(cfg *config.Config, db database.Store, providers *provider.Registry, sender *webhook.Sender) *CheckoutController {
+	return &CheckoutController{cfg: cfg, db: db, providers: providers, sender: sender}
+}
+
+type checkoutPage struct {
+	ID          string
+	PaymentURL  string
+	Amount      string
+	Currency    string
+	Description string
+	// PhoneHint is the masked payer phone; the payer has to type the
+	// number in Phone to approve
+	PhoneHint string
+	Phone     string
+	Status    string
+	ExpiresAt time.Time
+	// Open is true while the payer can still approve
+	Open bool
+	// Waiting is true once the payer approved and the provider has not
+	// answered yet
+	Waiting        bool
+	RefreshSeconds int
+	Error          string
+}
+
+// ShowCheckout renders the payment page, or sends the payer back to the
+// merchant once the payment is settled
+func (cc *CheckoutController) ShowCheckout(w http.ResponseWriter, r *http.Request) {
+	transaction, ok := cc.transaction(w, r)
+	if !ok {
+		return
+	}
+
+	if !isUnsettled(transaction.Status) {
+		if cc.redirectToMerchant(w, r, transaction) {
+			return
+		}
+		cc.render(w, http.StatusOK, cc.newCheckoutPage(transaction))
+		return
+	}
+
+	page := cc.newCheckoutPage(transaction)
+	page.Waiting = page.Open && (r.URL.Query().Get("waiting") != "" || transaction.Status == model.StatusProcessing)
+	cc.render(w, http.StatusOK, page)
+}
+
+// ApproveCheckout records the payer's approval: it checks the phone number
+// against the payment and asks the provider where the collection stands
+func (cc *CheckoutController) ApproveCheckout(w http.ResponseWriter, r *http.Request) {
+	transaction, ok := cc.transaction(w, r)
+	if !ok {
+		return
+	}
+	checkoutURL := generatePaymentURL(cc.cfg.Server.PublicBaseURL, transaction.ID)
+
+	if !isUnsettled(transaction.Status) {
+		http.Redirect(w, r, checkoutURL, http.StatusSeeOther)
+		return
+	}
+
+	page := cc.newCheckoutPage(transaction)
+	if !page.Open {
+		page.Error = "This payment has expired."
+		cc.render(w, http.StatusConflict, page)
+		return
+	}
+
+	phone := r.PostFormValue("phone")
+	page.Phone = phone
+	if provider.NormalizePhone(phone) != provider.NormalizePhone(transaction.PayerPhone) {
+		page.Error = "This payment was requested from another phone number."
+		cc.render(w, http.StatusUnprocessableEntity, page)
+		return
+	}
+
+	collector, ok := cc.providers.Get(transaction.Provider)
+	if !ok || transaction.ProviderReference == "" {
+		log.Error().Str("transactionID", transaction.ID).Str("provider", transaction.Provider).Msg("Transaction has no collection to approve")
+		page.Error = "The payment provider is unavailable, please try again later."
+		cc.render(w, http.StatusBadGateway, page)
+		return
+	}
+
+	result, err := collector.QueryStatus(r.Context(), transaction.ProviderReference)
+	if err != nil {
+		log.Error().Err(err).Str("transactionID", transaction.ID).Str("provider", transaction.Provider).Msg("Provider status query failed")
+		page.Error = "The payment provider is unavailable, please try again later."
+		cc.render(w, http.StatusBadGateway, page)
+		return
+	}
+
+	updated, changed, err := provider.Settle(cc.db, transaction, result.Status)
+	if err != nil {
+		log.Error().Err(err).Str("transactionID", transaction.ID).Str("status", result.Status).Msg("Failed to apply provider status")
+		page.Error = "The payment could not be updated, please try again."
+		cc.render(w, http.StatusConflict, page)
+		return
+	}
+	if changed && !isUnsettled(updated.Status) {
+		metrics.PaymentsResolved.WithLabelValues(metrics.SourceCheckout, updated.Status).Inc()
+	}
+
+	if isUnsettled(updated.Status) {
+		checkoutURL += "?waiting=1"
+	}
+	http.Redirect(w, r, checkoutURL, http.StatusSeeOther)
+}
+
+// transaction loads the transaction of the page, rendering not found when
+// there is none
+func (cc *CheckoutController) transaction(w http.ResponseWriter, r *http.Request) (*model.Transaction, bool) {
+	transactionID := mux.Vars(r)["id"]
+
+	transaction, err := cc.db.GetTransactionByID(transactionID)
+	if err != nil {
+		log.Error().Err(err).Str("transactionID", transactionID).Msg("Transaction retrieval failed")
+	}
+	if transaction == nil {
+		cc.render(w, http.StatusNotFound, checkoutPage{})
+		return nil, false
+	}
+	return transaction, true
+}
+
+// redirectToMerchant sends the payer to the merchant's callback URL for
+// the outcome of the payment, if the merchant gave one
+func (cc *CheckoutController) redirectToMerchant(w http.ResponseWriter, r *http.Request, transaction *model.Transaction) bool {
+	callbackURL := transaction.CallbackError
+	if transaction.Status == model.StatusSuccess {
+		callbackURL = transaction.CallbackSuccess
+	}
+	if callbackURL == "" {
+		return false
+	}
+
+	secrets, err := cc.sender.SigningSecrets(r.Context(), transaction.MerchantID)
+	if err != nil {
+		log.Error().Err(err).Str("transactionID", transaction.ID).Msg("Failed to load signing secrets")
+		return false
+	}
+	redirectURL, err := webhook.RedirectURL(callbackURL, transaction.ID, transaction.Status, time.Now(), secrets...)
+	if err != nil {
+		log.Error().Err(err).Str("transactionID", transaction.ID).Msg("Invalid callback URL")
+		return false
+	}
+
+	http.Redirect(w, r, redirectURL, http.StatusSeeOther)
+	return true
+}
+
+func (cc *CheckoutController) render(w http.ResponseWriter, status int, page checkoutPage) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	// The page takes payment approvals, so it must not be framed
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; script-src 'unsafe-inline'; frame-ancestors 'none'")
+	w.WriteHeader(status)
+
+	if err := checkoutTemplate.Execute(w, page); err != nil {
+		log.Error().Err(err).Str("transactionID", page.ID).Msg("Failed to render checkout page")
+	}
+}
+
+func (cc *CheckoutController) newCheckoutPage(transaction *model.Transaction) checkoutPage {
+	return checkoutPage{
+		ID:             transaction.ID,
+		PaymentURL:     generatePaymentURL(cc.cfg.Server.PublicBaseURL, transaction.ID),
+		Amount:         transaction.Amount.Decimal(),
+		Currency:       transaction.Amount.Currency,
+		Description:    transaction.Description,
+		PhoneHint:      maskPhone(transaction.PayerPhone),
+		Status:         transaction.Status,
+		ExpiresAt:      transaction.ExpiresAt,
+		Open:           isUnsettled(transaction.Status) && time.Now().Before(transaction.ExpiresAt),
+		RefreshSeconds: checkoutRefreshSeconds,
+	}
+}
+
+// maskPhone keeps the country code and last two digits of a phone number,
+// enough for the payer to recognize it without revealing it to anyone else
+// holding the payment link
+func maskPhone(phone string) string {
+	phone = provider.NormalizePhone(phone)
+	if len(phone) <= 6 {
+		return strings.Repeat("•", len(phone))
+	}
+	return phone[:4] + strings.Repeat("•", len(phone)-6) + phone[len(phone)-2:]
+}
+
+// isUnsettled reports whether the payer may still complete the payment
+func isUnsettled(status string) bool {
+	return status == model.StatusPending || status == model.StatusProcessing
+}
@@ -1,33 +1,47 @@
 package controllers
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"payment-server/config"
+	"payment-server/currency"
 	"payment-server/database"
+	"payment-server/middleware"
 	"payment-server/model"
+	"payment-server/money"
+	"payment-server/provider"
 	"payment-server/utils"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/rs/zerolog/log"
 )
 
+const maxCancellationReasonLength = 500
+
+var errTransactionExpired = errors.New("transaction has expired")
+
 type PaymentController struct {
-	db *database.Database
+	cfg       *config.Config
+	db        database.Store
+	providers *provider.Registry
 }
 
-func NewPaymentController(db *database.Database) *PaymentController {
-	return &PaymentController{db: db}
+func NewPaymentController(cfg *config.Config, db database.Store, providers *provider.Registry) *PaymentController {
+	return &PaymentController{cfg: cfg, db: db, providers: providers}
 }
 
 func (pc *PaymentController) InitializePayment(w http.ResponseWriter, r *http.Request) {
 	var req model.TransactionRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		log.Error().Err(err).Msg("Invalid request format")
-		utils.SendError(w, "Invalid request format", http.StatusBadRequest)
+		utils.SendError(w, invalidRequestMessage(err), http.StatusBadRequest)
 		return
 	}
 	defer r.Body.Close()
@@ -39,24 +53,46 @@ func (pc *PaymentController) InitializePayment(w http.ResponseWriter, r *http.Re
 		return
 	}
 
+	if err := pc.validateCallbackURLs(r.Context(), middleware.ClientID(r), req.CallbackURLs); err != nil {
+		utils.SendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	collector, err := pc.providers.Resolve(req.Provider, req.PayerPhone)
+	if errors.Is(err, provider.ErrUnknownProvider) {
+		utils.SendError(w, fmt.Sprintf("unknown provider: %q", req.Provider), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		utils.SendError(w, "no payment provider serves this phone number", http.StatusBadRequest)
+		return
+	}
+
 	// Create transaction
-	transaction := createTransactionFromRequest(&req)
+	transaction := createTransactionFromRequest(&req, pc.cfg.Payments.TransactionExpiry.Duration)
+	transaction.MerchantID = middleware.ClientID(r)
+	transaction.Provider = collector.Code()
 
 	// Save transaction to database
-	if err := pc.db.SaveTransaction(&database.Transaction{
-		ID:        transaction.ID,
-		Amount:    transaction.Amount,
-		Status:    transaction.Status,
-		CreatedAt: transaction.CreatedAt,
-		UpdatedAt: transaction.CreatedAt,
-	}); err != nil {
+	if err := pc.db.SaveTransaction(&transaction); err != nil {
 		log.Error().Err(err).Msg("Failed to save transaction")
 		utils.SendError(w, "Failed to process transaction", http.StatusInternalServerError)
 		return
 	}
 
+	// The transaction is saved first so that a collection started at the
+	// provider always has a transaction to report back to
+	if err := pc.initiateCollection(r.Context(), collector, &transaction); err != nil {
+		log.Error().Err(err).Str("transactionID", transaction.ID).Str("provider", collector.Code()).Msg("Failed to initiate collection")
+		if _, err := pc.db.UpdateTransactionStatus(transaction.ID, transaction.Status, model.StatusError); err != nil {
+			log.Error().Err(err).Str("transactionID", transaction.ID).Msg("Failed to update transaction status")
+		}
+		utils.SendError(w, "Payment provider is unavailable", http.StatusBadGateway)
+		return
+	}
+
 	// Generate payment URL
-	paymentURL := generatePaymentURL(transaction.ID)
+	paymentURL := generatePaymentURL(pc.cfg.Server.PublicBaseURL, transaction.ID)
 
 	response := model.TransactionResponse{
 		Success:     true,
@@ -68,34 +104,55 @@ func (pc *PaymentController) InitializePayment(w http.ResponseWriter, r *http.Re
 	utils.SendSuccess(w, response, http.StatusCreated)
 }
 
+// initiateCollection asks the provider to collect transaction and records
+// the provider's reference and any status it already knows
+func (pc *PaymentController) initiateCollection(ctx context.Context, collector provider.Provider, transaction *model.Transaction) error {
+	result, err := collector.InitiateCollection(ctx, provider.Collection{
+		TransactionID: transaction.ID,
+		Amount:        transaction.Amount,
+		PayerPhone:    transaction.PayerPhone,
+		Description:   transaction.Description,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := pc.db.SetProviderReference(transaction.ID, result.Reference); err != nil {
+		return err
+	}
+	transaction.ProviderReference = result.Reference
+
+	if result.Status != transaction.Status {
+		updated, err := pc.db.UpdateTransactionStatus(transaction.ID, transaction.Status, result.Status)
+		if err != nil {
+			return err
+		}
+		*transaction = *updated
+	}
+	return nil
+}
+
 func (pc *PaymentController) GetPaymentStatus(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	transactionID := vars["id"]
 
-	dbTransaction, err := pc.db.GetTransactionByID(transactionID)
+	transaction, err := pc.db.GetTransactionByID(transactionID)
 	if err != nil {
 		log.Error().Err(err).Str("transactionID", transactionID).Msg("Transaction retrieval failed")
 		utils.SendError(w, "Transaction not found", http.StatusNotFound)
 		return
 	}
 
-	if dbTransaction == nil {
+	// Other merchants' transactions are reported as missing
+	if transaction == nil || transaction.MerchantID != middleware.ClientID(r) {
 		utils.SendError(w, "Transaction not found", http.StatusNotFound)
 		return
 	}
 
-	transaction := model.Transaction{
-		ID:        dbTransaction.ID,
-		Amount:    dbTransaction.Amount,
-		Status:    dbTransaction.Status,
-		CreatedAt: dbTransaction.CreatedAt,
-		UpdatedAt: dbTransaction.UpdatedAt,
-	}
-
 	response := model.TransactionResponse{
 		Success:     true,
 		Message:     "Status retrieved successfully",
-		Transaction: transaction,
+		Transaction: *transaction,
 	}
 
 	utils.SendSuccess(w, response, http.StatusOK)
@@ -105,50 +162,36 @@ func (pc *PaymentController) ConfirmPayment(w http.ResponseWriter, r *http.Reque
 	vars := mux.Vars(r)
 	transactionID := vars["id"]
 
-	dbTransaction, err := pc.db.GetTransactionByID(transactionID)
+	transaction, err := pc.db.GetTransactionByID(transactionID)
 	if err != nil {
 		log.Error().Err(err).Str("transactionID", transactionID).Msg("Transaction retrieval failed")
 		utils.SendError(w, "Transaction not found", http.StatusNotFound)
 		return
 	}
 
-	if dbTransaction == nil {
+	if transaction == nil {
 		utils.SendError(w, "Transaction not found", http.StatusNotFound)
 		return
 	}
 
-	transaction := model.Transaction{
-		ID:        dbTransaction.ID,
-		Amount:    dbTransaction.Amount,
-		Status:    dbTransaction.Status,
-		CreatedAt: dbTransaction.CreatedAt,
-		UpdatedAt: dbTransaction.UpdatedAt,
-	}
-
-	if err := validateTransactionConfirmation(&transaction); err != nil {
+	if err := validateTransactionConfirmation(transaction); err != nil {
 		log.Error().Err(err).Str("transactionID", transactionID).Msg("Transaction confirmation validation failed")
-		utils.SendError(w, err.Error(), http.StatusBadRequest)
+		sendStatusUpdateError(w, err, "confirm")
 		return
 	}
 
 	// Update transaction status in database
-	if err := pc.db.UpdateTransactionStatus(transactionID, model.StatusSuccess); err != nil {
+	transaction, err = pc.db.UpdateTransactionStatus(transactionID, transaction.Status, model.StatusSuccess)
+	if err != nil {
 		log.Error().Err(err).Str("transactionID", transactionID).Msg("Failed to update transaction status")
-		utils.SendError(w, "Failed to confirm transaction", http.StatusInternalServerError)
+		sendStatusUpdateError(w, err, "confirm")
 		return
 	}
 
-	transaction.Status = model.StatusSuccess
-	transaction.UpdatedAt = time.Now()
-
-	if transaction.WebhookURL != "" {
-		go sendWebhook(r.Context(), transaction)
-	}
-
 	response := model.TransactionResponse{
 		Success:     true,
 		Message:     "Payment confirmed successfully",
-		Transaction: transaction,
+		Transaction: *transaction,
 	}
 
 	utils.SendSuccess(w, response, http.StatusOK)
@@ -158,47 +201,113 @@ func (pc *PaymentController) RejectPayment(w http.ResponseWriter, r *http.Reques
 	vars := mux.Vars(r)
 	transactionID := vars["id"]
 
-	dbTransaction, err := pc.db.GetTransactionByID(transactionID)
+	transaction, err := pc.db.GetTransactionByID(transactionID)
 	if err != nil {
 		log.Error().Err(err).Str("transactionID", transactionID).Msg("Transaction retrieval failed")
 		utils.SendError(w, "Transaction not found", http.StatusNotFound)
 		return
 	}
 
-	if dbTransaction == nil {
+	if transaction == nil {
 		utils.SendError(w, "Transaction not found", http.StatusNotFound)
 		return
 	}
 
-	if err := pc.db.UpdateTransactionStatus(transactionID, model.StatusError); err != nil {
+	transaction, err = pc.db.UpdateTransactionStatus(transactionID, transaction.Status, model.StatusError)
+	if err != nil {
 		log.Error().Err(err).Str("transactionID", transactionID).Msg("Failed to update transaction status")
-		utils.SendError(w, "Failed to reject transaction", http.StatusInternalServerError)
+		sendStatusUpdateError(w, err, "reject")
+		return
+	}
+
+	response := model.TransactionResponse{
+		Success:     true,
+		Message:     "Payment rejected successfully",
+		Transaction: *transaction,
+	}
+
+	utils.SendSuccess(w, response, http.StatusOK)
+}
+
+func (pc *PaymentController) CancelPayment(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	transactionID := vars["id"]
+
+	// The reason is optional, so an empty body is accepted
+	var req model.CancelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		log.Error().Err(err).Msg("Invalid request format")
+		utils.SendError(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if len(req.Reason) > maxCancellationReasonLength {
+		utils.SendError(w, fmt.Sprintf("cancellation reason must be at most %d characters", maxCancellationReasonLength), http.StatusBadRequest)
+		return
+	}
+
+	transaction, err := pc.db.GetTransactionByID(transactionID)
+	if err != nil {
+		log.Error().Err(err).Str("transactionID", transactionID).Msg("Transaction retrieval failed")
+		utils.SendError(w, "Transaction not found", http.StatusNotFound)
 		return
 	}
 
-	transaction := model.Transaction{
-		ID:        dbTransaction.ID,
-		Amount:    dbTransaction.Amount,
-		Status:    model.StatusError,
-		CreatedAt: dbTransaction.CreatedAt,
-		UpdatedAt: time.Now(),
+	if transaction == nil || transaction.MerchantID != middleware.ClientID(r) {
+		utils.SendError(w, "Transaction not found", http.StatusNotFound)
+		return
 	}
 
-	if transaction.WebhookURL != "" {
-		go sendWebhook(r.Context(), transaction)
+	transaction, err = pc.db.CancelTransaction(transactionID, transaction.Status, req.Reason)
+	if err != nil {
+		log.Error().Err(err).Str("transactionID", transactionID).Msg("Failed to cancel transaction")
+		sendStatusUpdateError(w, err, "cancel")
+		return
 	}
 
 	response := model.TransactionResponse{
 		Success:     true,
-		Message:     "Payment rejected successfully",
-		Transaction: transaction,
+		Message:     "Payment cancelled successfully",
+		Transaction: *transaction,
 	}
 
 	utils.SendSuccess(w, response, http.StatusOK)
 }
 
+// GetPaymentWebhooks lists the webhook events queued for a transaction
+// together with every delivery attempt
+func (pc *PaymentController) GetPaymentWebhooks(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	transactionID := vars["id"]
+
+	transaction, err := pc.db.GetTransactionByID(transactionID)
+	if err != nil {
+		log.Error().Err(err).Str("transactionID", transactionID).Msg("Transaction retrieval failed")
+		utils.SendError(w, "Transaction not found", http.StatusNotFound)
+		return
+	}
+
+	if transaction == nil || transaction.MerchantID != middleware.ClientID(r) {
+		utils.SendError(w, "Transaction not found", http.StatusNotFound)
+		return
+	}
+
+	events, err := pc.db.ListWebhookEvents(r.Context(), transactionID)
+	if err != nil {
+		log.Error().Err(err).Str("transactionID", transactionID).Msg("Webhook events retrieval failed")
+		utils.SendError(w, "Failed to retrieve webhook events", http.StatusInternalServerError)
+		return
+	}
+
+	utils.SendSuccess(w, model.WebhookEventsResponse{Success: true, Events: events}, http.StatusOK)
+}
+
 func validateTransactionRequest(req *model.TransactionRequest) error {
-	if req.Amount <= 0 {
+	if !currency.IsSupported(req.Amount.Currency) {
+		return fmt.Errorf("unsupported currency: %q", req.Amount.Currency)
+	}
+	if !req.Amount.IsPositive() {
 		return fmt.Errorf("invalid amount: must be positive")
 	}
 	if req.PayerPhone == "" {
@@ -210,74 +319,97 @@ func validateTransactionRequest(req *model.TransactionRequest) error {
 	return nil
 }
 
-func createTransactionFromRequest(req *model.TransactionRequest) model.Transaction {
+// validateCallbackURLs requires the callback URLs the payer is redirected
+// to to be absolute https URLs on a host the merchant allowlisted
+func (pc *PaymentController) validateCallbackURLs(ctx context.Context, merchantID string, callbackURLs model.CallbackURLs) error {
+	if callbackURLs.Success == "" && callbackURLs.Error == "" {
+		return nil
+	}
+
+	hosts, err := pc.db.ListCallbackHosts(ctx, merchantID)
+	if err != nil {
+		log.Error().Err(err).Str("merchantID", merchantID).Msg("Failed to list callback hosts")
+		return fmt.Errorf("failed to check callback URLs")
+	}
+	allowed := make(map[string]bool, len(hosts))
+	for _, host := range hosts {
+		allowed[host.Host] = true
+	}
+
+	for _, callback := range []struct{ name, url string }{
+		{"success", callbackURLs.Success},
+		{"error", callbackURLs.Error},
+	} {
+		if callback.url == "" {
+			continue
+		}
+		u, err := url.Parse(callback.url)
+		if err != nil || u.Scheme != "https" || u.Host == "" || u.User != nil {
+			return fmt.Errorf("callback_urls.%s must be an absolute https URL", callback.name)
+		}
+		if host := strings.ToLower(u.Hostname()); !allowed[host] {
+			return fmt.Errorf("callback_urls.%s host %q is not allowlisted", callback.name, host)
+		}
+	}
+	return nil
+}
+
+// invalidRequestMessage explains a body that failed to decode when the
+// problem is a malformed amount
+func invalidRequestMessage(err error) string {
+	for _, amountErr := range []error{money.ErrInvalidAmount, money.ErrPrecision, money.ErrOverflow, money.ErrUnknownCurrency} {
+		if errors.Is(err, amountErr) {
+			return err.Error()
+		}
+	}
+	return "Invalid request format"
+}
+
+func createTransactionFromRequest(req *model.TransactionRequest, expiry time.Duration) model.Transaction {
 	now := time.Now()
 	return model.Transaction{
 		ID:              utils.GenerateTransactionID(),
 		Amount:          req.Amount,
-		Currency:        req.Currency,
 		Status:          model.StatusPending,
 		PayerPhone:      req.PayerPhone,
 		Description:     req.Description,
 		Reference:       req.Reference,
 		CreatedAt:       now,
 		UpdatedAt:       now,
-		ExpiresAt:       now.Add(15 * time.Minute),
+		ExpiresAt:       now.Add(expiry),
 		WebhookURL:      req.WebhookURL,
 		CallbackSuccess: req.CallbackURLs.Success,
 		CallbackError:   req.CallbackURLs.Error,
 	}
 }
 
-func generatePaymentURL(transactionID string) string {
-	return fmt.Sprintf("http://localhost:8082/pay/%s", transactionID)
+func generatePaymentURL(baseURL, transactionID string) string {
+	return fmt.Sprintf("%s/pay/%s", strings.TrimRight(baseURL, "/"), transactionID)
 }
 
 func validateTransactionConfirmation(transaction *model.Transaction) error {
-	if transaction.Status != model.StatusPending {
-		return fmt.Errorf("transaction cannot be confirmed in current state: %s", transaction.Status)
+	if err := model.ValidateTransition(transaction.Status, model.StatusSuccess); err != nil {
+		return err
 	}
 	if time.Now().After(transaction.ExpiresAt) {
-		return fmt.Errorf("transaction has expired")
+		return errTransactionExpired
 	}
 	return nil
 }
 
-func sendWebhook(ctx context.Context, transaction model.Transaction) {
-	payload := map[string]interface{}{
-		"event_type": "payment.updated",
-		"data":       transaction,
-	}
-
-	jsonPayload, err := json.Marshal(payload)
-	if err != nil {
-		log.Error().Err(err).Str("transactionID", transaction.ID).Msg("Failed to marshal webhook payload")
-		return
-	}
-
-	req, err := http.NewRequestWithContext(ctx, "POST", transaction.WebhookURL, bytes.NewBuffer(jsonPayload))
-	if err != nil {
-		log.Error().Err(err).Str("transactionID", transaction.ID).Msg("Failed to create webhook request")
-		return
-	}
-	
-	req.Header.Set("Content-Type", "application/json")
-	
-	client := &http.Client{
-		Timeout: 10 * time.Second,
-	}
-	
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Error().Err(err).Str("transactionID", transaction.ID).Msg("Failed to send webhook")
-		return
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode >= 400 {
-		log.Error().
-			Str("transactionID", transaction.ID).
-			Int("statusCode", resp.StatusCode).
-			Msg("Webhook request failed")
+// sendStatusUpdateError maps a failed status change onto an HTTP response
+func sendStatusUpdateError(w http.ResponseWriter, err error, action string) {
+	var transitionErr *model.TransitionError
+	switch {
+	case errors.As(err, &transitionErr):
+		utils.SendError(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, model.ErrStatusConflict):
+		utils.SendError(w, "Transaction was updated by another request", http.StatusConflict)
+	case errors.Is(err, model.ErrTransactionNotFound):
+		utils.SendError(w, "Transaction not found", http.StatusNotFound)
+	case errors.Is(err, errTransactionExpired):
+		utils.SendError(w, err.Error(), http.StatusBadRequest)
+	default:
+		utils.SendError(w, fmt.Sprintf("Failed to %s transaction", action), http.StatusInternalServerError)
 	}
-}
\ No newline at end of file
+}
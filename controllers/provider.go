@@ -0,0 +1,117 @@
+package controllers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"payment-server/database"
+	"payment-server/metrics"
+	"payment-server/model"
+	"payment-server/provider"
+	"payment-server/utils"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog/log"
+)
+
+const maxCallbackBodySize = 64 << 10
+
+// ProviderController receives the status updates that mobile money
+// providers push for their collections
+type ProviderController struct {
+	db        database.Store
+	providers *provider.Registry
+}
+
+func NewProviderController(db database.Store, providers *provider.Registry) *ProviderController {
+	return &ProviderController{db: db, providers: providers}
+}
+
+// HandleCallback verifies a provider callback and settles the transaction
+// it reports on. Providers retry until they get a 2xx, so a callback that
+// was already applied is acknowledged again rather than rejected.
+func (pc *ProviderController) HandleCallback(w http.ResponseWriter, r *http.Request) {
+	code := mux.Vars(r)["provider"]
+	collector, ok := pc.providers.Get(code)
+	if !ok {
+		utils.SendError(w, "Unknown provider", http.StatusNotFound)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxCallbackBodySize))
+	if err != nil {
+		utils.SendError(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	callback, err := collector.HandleCallback(r.Context(), r.Header, body)
+	if errors.Is(err, provider.ErrInvalidSignature) {
+		log.Warn().Err(err).Str("provider", code).Msg("Rejected provider callback")
+		utils.SendError(w, "Invalid callback signature", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Str("provider", code).Msg("Invalid provider callback")
+		utils.SendError(w, "Invalid callback", http.StatusBadRequest)
+		return
+	}
+
+	transaction, err := pc.callbackTransaction(code, callback)
+	if err != nil {
+		log.Error().Err(err).Str("provider", code).Msg("Transaction retrieval failed")
+		utils.SendError(w, "Failed to process callback", http.StatusInternalServerError)
+		return
+	}
+	if transaction == nil {
+		log.Warn().Str("provider", code).Str("reference", callback.Reference).Msg("Callback for unknown transaction")
+		utils.SendError(w, "Transaction not found", http.StatusNotFound)
+		return
+	}
+
+	current := transaction
+	transaction, changed, err := provider.Settle(pc.db, transaction, callback.Status)
+	var transitionErr *model.TransitionError
+	if errors.As(err, &transitionErr) {
+		// Retrying will not make the transition valid, so acknowledge it
+		// with the status the transaction keeps
+		log.Warn().Err(err).Str("transactionID", current.ID).Str("provider", code).Str("status", callback.Status).Msg("Ignored provider callback that cannot be applied")
+		utils.SendSuccess(w, model.ProviderCallbackResponse{Success: true, Message: "Callback ignored: " + err.Error(), Status: transitionErr.From}, http.StatusOK)
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Str("transactionID", current.ID).Str("provider", code).Str("status", callback.Status).Msg("Failed to apply provider callback")
+		sendStatusUpdateError(w, err, "update")
+		return
+	}
+
+	message := "Callback already applied"
+	if changed {
+		message = "Callback applied"
+		metrics.PaymentsResolved.WithLabelValues(metrics.SourceCallback, transaction.Status).Inc()
+		log.Info().Str("transactionID", transaction.ID).Str("provider", code).Str("status", transaction.Status).Msg("Transaction settled by provider callback")
+	}
+	utils.SendSuccess(w, model.ProviderCallbackResponse{Success: true, Message: message, Status: transaction.Status}, http.StatusOK)
+}
+
+// callbackTransaction finds the transaction a callback refers to, by the
+// provider's reference when it sent one. A transaction collected by another
+// provider is treated as missing.
+func (pc *ProviderController) callbackTransaction(code string, callback *provider.Callback) (*model.Transaction, error) {
+	if callback.Reference != "" {
+		transaction, err := pc.db.GetTransactionByProviderReference(code, callback.Reference)
+		if err != nil || transaction == nil {
+			return nil, err
+		}
+		if callback.TransactionID != "" && callback.TransactionID != transaction.ID {
+			return nil, nil
+		}
+		return transaction, nil
+	}
+
+	transaction, err := pc.db.GetTransactionByID(callback.TransactionID)
+	if err != nil || transaction == nil || transaction.Provider != code {
+		return nil, err
+	}
+	return transaction, nil
+}
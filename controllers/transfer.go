@@ -0,0 +1,215 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"payment-server/currency"
+	"payment-server/database"
+	"payment-server/ledger"
+	"payment-server/middleware"
+	"payment-server/model"
+	"payment-server/money"
+	"payment-server/utils"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	maxTransferDescriptionLength = 500
+	maxTransferReferenceLength   = 255
+)
+
+// TransferController moves funds between accounts through the ledger
+type TransferController struct {
+	db database.Store
+}
+
+func NewTransferController(db database.Store) *TransferController {
+	return &TransferController{db: db}
+}
+
+// CreateTransfer debits one of the user's accounts and credits the
+// destination account, which may belong to anyone
+func (tc *TransferController) CreateTransfer(w http.ResponseWriter, r *http.Request) {
+	var req model.TransferRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.SendError(w, invalidRequestMessage(err), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if err := validateTransferRequest(&req); err != nil {
+		utils.SendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	from, err := tc.db.GetAccountByID(r.Context(), req.FromAccountID)
+	if err != nil {
+		log.Error().Err(err).Str("accountID", req.FromAccountID).Msg("Account retrieval failed")
+		utils.SendError(w, "Failed to process transfer", http.StatusInternalServerError)
+		return
+	}
+	if from == nil || from.UserID != middleware.UserID(r.Context()) {
+		utils.SendError(w, "Source account not found", http.StatusNotFound)
+		return
+	}
+	to, err := tc.db.GetAccountByID(r.Context(), req.ToAccountID)
+	if err != nil {
+		log.Error().Err(err).Str("accountID", req.ToAccountID).Msg("Account retrieval failed")
+		utils.SendError(w, "Failed to process transfer", http.StatusInternalServerError)
+		return
+	}
+	if to == nil || to.Kind == model.AccountClearing {
+		utils.SendError(w, "Destination account not found", http.StatusNotFound)
+		return
+	}
+	if from.Currency != to.Currency {
+		utils.SendError(w, "Both accounts must hold the same currency", http.StatusBadRequest)
+		return
+	}
+	if req.Amount.Currency != from.Currency {
+		utils.SendError(w, fmt.Sprintf("amount must be in %s, the currency of the accounts", from.Currency), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	transfer := &model.Transfer{
+		ID:            utils.GenerateID(),
+		FromAccountID: from.ID,
+		ToAccountID:   to.ID,
+		Amount:        req.Amount,
+		Status:        model.TransferCompleted,
+		Description:   req.Description,
+		Reference:     req.Reference,
+		ExecutedAt:    &now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	entry := ledger.TransferEntry(transfer.ID, from.ID, to.ID, transfer.Amount.Amount, transfer.Amount.Currency, transfer.Description)
+	entry.CreatedAt = now
+	if err := ledger.Prepare(entry); err != nil {
+		utils.SendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if _, err := tc.db.CreateTransfer(r.Context(), transfer, entry); err != nil {
+		log.Error().Err(err).Str("fromAccountID", from.ID).Str("toAccountID", to.ID).Msg("Transfer failed")
+		sendLedgerError(w, err, transfer.Amount.Currency)
+		return
+	}
+
+	utils.SendSuccess(w, model.TransferResponse{
+		Success:  true,
+		Message:  "Transfer completed successfully",
+		Transfer: *transfer,
+	}, http.StatusCreated)
+}
+
+// GetTransfer shows a transfer to the owner of either account
+func (tc *TransferController) GetTransfer(w http.ResponseWriter, r *http.Request) {
+	transferID := mux.Vars(r)["id"]
+	transfer, err := tc.db.GetTransferByID(r.Context(), transferID)
+	if err != nil {
+		log.Error().Err(err).Str("transferID", transferID).Msg("Transfer retrieval failed")
+		utils.SendError(w, "Failed to retrieve transfer", http.StatusInternalServerError)
+		return
+	}
+	if transfer == nil {
+		utils.SendError(w, "Transfer not found", http.StatusNotFound)
+		return
+	}
+
+	visible, err := tc.ownsEither(r, transfer.FromAccountID, transfer.ToAccountID)
+	if err != nil {
+		log.Error().Err(err).Str("transferID", transferID).Msg("Account retrieval failed")
+		utils.SendError(w, "Failed to retrieve transfer", http.StatusInternalServerError)
+		return
+	}
+	if !visible {
+		utils.SendError(w, "Transfer not found", http.StatusNotFound)
+		return
+	}
+
+	utils.SendSuccess(w, model.TransferResponse{Success: true, Transfer: *transfer}, http.StatusOK)
+}
+
+func (tc *TransferController) ownsEither(r *http.Request, accountIDs ...string) (bool, error) {
+	userID := middleware.UserID(r.Context())
+	for _, id := range accountIDs {
+		account, err := tc.db.GetAccountByID(r.Context(), id)
+		if err != nil {
+			return false, err
+		}
+		if account != nil && account.UserID == userID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func validateTransferRequest(req *model.TransferRequest) error {
+	if !currency.IsSupported(req.Amount.Currency) {
+		return fmt.Errorf("unsupported currency: %q", req.Amount.Currency)
+	}
+	if !req.Amount.IsPositive() {
+		return fmt.Errorf("invalid amount: must be positive")
+	}
+	if req.FromAccountID == "" || req.ToAccountID == "" {
+		return fmt.Errorf("from_account_id and to_account_id are required")
+	}
+	if req.FromAccountID == req.ToAccountID {
+		return fmt.Errorf("cannot transfer to the same account")
+	}
+	if len(req.Description) > maxTransferDescriptionLength {
+		return fmt.Errorf("description must be at most %d characters", maxTransferDescriptionLength)
+	}
+	if len(req.Reference) > maxTransferReferenceLength {
+		return fmt.Errorf("reference must be at most %d characters", maxTransferReferenceLength)
+	}
+	return nil
+}
+
+// limitMessages describe each ledger.LimitError code given the limit
+var limitMessages = map[string]func(limit money.Money) string{
+	ledger.SingleTransferLimitExceeded: func(limit money.Money) string {
+		return fmt.Sprintf("Amount exceeds the single transfer limit of %s", limit)
+	},
+	ledger.DailyTransferLimitExceeded: func(limit money.Money) string {
+		return fmt.Sprintf("Transfer would exceed the daily limit of %s", limit)
+	},
+	ledger.MonthlyTransferLimitExceeded: func(limit money.Money) string {
+		return fmt.Sprintf("Transfer would exceed the monthly limit of %s", limit)
+	},
+	ledger.MinBalanceBreached: func(limit money.Money) string {
+		return fmt.Sprintf("Transfer would take the balance below the minimum of %s", limit)
+	},
+	ledger.MaxBalanceExceeded: func(limit money.Money) string {
+		return fmt.Sprintf("Transfer would take the recipient's balance above the maximum of %s", limit)
+	},
+}
+
+// sendLedgerError maps a rejected ledger entry in currency onto an HTTP
+// response
+func sendLedgerError(w http.ResponseWriter, err error, currency string) {
+	var limit *ledger.LimitError
+	switch {
+	case errors.As(err, &limit):
+		utils.SendErrorCode(w, limit.Code, limitMessages[limit.Code](money.Money{Amount: limit.Limit, Currency: currency}), http.StatusUnprocessableEntity)
+	case errors.Is(err, ledger.ErrInsufficientFunds):
+		utils.SendError(w, "Insufficient funds", http.StatusUnprocessableEntity)
+	case errors.Is(err, ledger.ErrAccountNotActive):
+		utils.SendError(w, "Both accounts must be active", http.StatusUnprocessableEntity)
+	case errors.Is(err, ledger.ErrCurrencyMismatch):
+		utils.SendError(w, "Both accounts must hold the same currency", http.StatusBadRequest)
+	case errors.Is(err, ledger.ErrUnknownAccount):
+		utils.SendError(w, "Account not found", http.StatusNotFound)
+	case errors.Is(err, ledger.ErrOverflow):
+		utils.SendError(w, "Amount is out of range", http.StatusUnprocessableEntity)
+	default:
+		utils.SendError(w, "Failed to process transfer", http.StatusInternalServerError)
+	}
+}
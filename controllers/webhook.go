@@ -0,0 +1,180 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"payment-server/config"
+	"payment-server/database"
+	"payment-server/middleware"
+	"payment-server/model"
+	"payment-server/utils"
+	"payment-server/webhook"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog/log"
+)
+
+// maxCallbackHostLength is the longest DNS name
+const maxCallbackHostLength = 253
+
+// WebhookController manages the secrets used to sign a merchant's webhooks
+type WebhookController struct {
+	cfg *config.Config
+	db  database.Store
+}
+
+func NewWebhookController(cfg *config.Config, db database.Store) *WebhookController {
+	return &WebhookController{cfg: cfg, db: db}
+}
+
+// RotateSecret creates a new signing secret and returns it once. The
+// previous secret keeps signing alongside it for the rotation grace period.
+func (wc *WebhookController) RotateSecret(w http.ResponseWriter, r *http.Request) {
+	merchantID := middleware.ClientID(r)
+
+	value, err := webhook.NewSecret()
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to generate webhook secret")
+		utils.SendError(w, "Failed to rotate webhook secret", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	secret := &model.WebhookSecret{
+		ID:         utils.GenerateID(),
+		MerchantID: merchantID,
+		Secret:     value,
+		CreatedAt:  now,
+	}
+	if err := wc.db.RotateWebhookSecret(r.Context(), secret, now.Add(wc.cfg.Webhooks.SecretRotationGrace.Duration)); err != nil {
+		log.Error().Err(err).Str("merchantID", merchantID).Msg("Failed to rotate webhook secret")
+		utils.SendError(w, "Failed to rotate webhook secret", http.StatusInternalServerError)
+		return
+	}
+
+	utils.SendSuccess(w, model.WebhookSecretsResponse{
+		Success: true,
+		Secrets: []model.WebhookSecret{*secret},
+	}, http.StatusCreated)
+}
+
+// provisionWebhookSecret gives a merchant its first signing secret, so that
+// its webhooks and checkout redirects can be signed from the start
+func provisionWebhookSecret(ctx context.Context, db database.Store, merchantID string) error {
+	active, err := db.ListActiveWebhookSecrets(ctx, merchantID, time.Now())
+	if err != nil {
+		return err
+	}
+	if len(active) > 0 {
+		return nil
+	}
+
+	value, err := webhook.NewSecret()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	secret := &model.WebhookSecret{
+		ID:         utils.GenerateID(),
+		MerchantID: merchantID,
+		Secret:     value,
+		CreatedAt:  now,
+	}
+	return db.RotateWebhookSecret(ctx, secret, now)
+}
+
+// ListSecrets shows the merchant's active secrets with their values redacted
+func (wc *WebhookController) ListSecrets(w http.ResponseWriter, r *http.Request) {
+	merchantID := middleware.ClientID(r)
+
+	secrets, err := wc.db.ListActiveWebhookSecrets(r.Context(), merchantID, time.Now())
+	if err != nil {
+		log.Error().Err(err).Str("merchantID", merchantID).Msg("Failed to list webhook secrets")
+		utils.SendError(w, "Failed to list webhook secrets", http.StatusInternalServerError)
+		return
+	}
+
+	redacted := make([]model.WebhookSecret, len(secrets))
+	for i, secret := range secrets {
+		redacted[i] = secret.Redacted()
+	}
+	utils.SendSuccess(w, model.WebhookSecretsResponse{Success: true, Secrets: redacted}, http.StatusOK)
+}
+
+// ListCallbackHosts shows the hosts the merchant allows in callback URLs
+func (wc *WebhookController) ListCallbackHosts(w http.ResponseWriter, r *http.Request) {
+	merchantID := middleware.ClientID(r)
+
+	hosts, err := wc.db.ListCallbackHosts(r.Context(), merchantID)
+	if err != nil {
+		log.Error().Err(err).Str("merchantID", merchantID).Msg("Failed to list callback hosts")
+		utils.SendError(w, "Failed to list callback hosts", http.StatusInternalServerError)
+		return
+	}
+	utils.SendSuccess(w, model.CallbackHostsResponse{Success: true, Hosts: hosts}, http.StatusOK)
+}
+
+// AddCallbackHost allowlists a host for the merchant's callback URLs
+func (wc *WebhookController) AddCallbackHost(w http.ResponseWriter, r *http.Request) {
+	merchantID := middleware.ClientID(r)
+
+	var req model.CallbackHostRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.SendError(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	host, err := normalizeCallbackHost(req.Host)
+	if err != nil {
+		utils.SendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	callbackHost := &model.CallbackHost{MerchantID: merchantID, Host: host, CreatedAt: time.Now()}
+	if err := wc.db.AddCallbackHost(r.Context(), callbackHost); err != nil {
+		log.Error().Err(err).Str("merchantID", merchantID).Msg("Failed to add callback host")
+		utils.SendError(w, "Failed to add callback host", http.StatusInternalServerError)
+		return
+	}
+	utils.SendSuccess(w, model.CallbackHostsResponse{Success: true, Hosts: []model.CallbackHost{*callbackHost}}, http.StatusCreated)
+}
+
+// RemoveCallbackHost stops allowing a host in new callback URLs. Payments
+// created before keep redirecting to it.
+func (wc *WebhookController) RemoveCallbackHost(w http.ResponseWriter, r *http.Request) {
+	merchantID := middleware.ClientID(r)
+	host := strings.ToLower(mux.Vars(r)["host"])
+
+	err := wc.db.RemoveCallbackHost(r.Context(), merchantID, host)
+	if errors.Is(err, database.ErrCallbackHostNotFound) {
+		utils.SendError(w, "Callback host not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Str("merchantID", merchantID).Msg("Failed to remove callback host")
+		utils.SendError(w, "Failed to remove callback host", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// normalizeCallbackHost lowercases a bare host name such as
+// "shop.example.com", rejecting schemes, ports and paths
+func normalizeCallbackHost(host string) (string, error) {
+	host = strings.ToLower(strings.TrimSpace(host))
+	if host == "" || len(host) > maxCallbackHostLength {
+		return "", fmt.Errorf("host must be between 1 and %d characters", maxCallbackHostLength)
+	}
+	u, err := url.Parse("https://" + host)
+	if err != nil || u.Host != host || u.Hostname() != host {
+		return "", fmt.Errorf("invalid host %q: give a host name without scheme, port or path", host)
+	}
+	return host, nil
+}
@@ -0,0 +1,98 @@
+// Package currency is the single list of currencies the server knows. The
+// supported_currency Postgres enum is generated from it and checked against
+// it at startup.
+package currency
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Currency is an ISO 4217 currency. Exponent is its number of decimals.
+// A currency that is not Enabled stays valid for stored data but is
+// refused in new requests.
+type Currency struct {
+	Code     string `json:"code"`
+	Exponent int    `json:"exponent"`
+	Name     string `json:"name"`
+	Enabled  bool   `json:"enabled"`
+}
+
+// registry is in the order of the supported_currency enum
+var registry = []Currency{
+	{Code: "USD", Exponent: 2, Name: "US Dollar", Enabled: true},
+	{Code: "EUR", Exponent: 2, Name: "Euro", Enabled: true},
+	{Code: "GBP", Exponent: 2, Name: "Pound Sterling", Enabled: true},
+	{Code: "JPY", Exponent: 0, Name: "Yen", Enabled: true},
+	{Code: "CNY", Exponent: 2, Name: "Yuan Renminbi", Enabled: true},
+	{Code: "SGD", Exponent: 2, Name: "Singapore Dollar", Enabled: true},
+	{Code: "XOF", Exponent: 0, Name: "CFA Franc BCEAO", Enabled: true},
+	{Code: "CHF", Exponent: 2, Name: "Swiss Franc", Enabled: true},
+	{Code: "HKD", Exponent: 2, Name: "Hong Kong Dollar", Enabled: true},
+	{Code: "NZD", Exponent: 2, Name: "New Zealand Dollar", Enabled: true},
+}
+
+var byCode = func() map[string]Currency {
+	m := make(map[string]Currency, len(registry))
+	for _, c := range registry {
+		m[c.Code] = c
+	}
+	return m
+}()
+
+// Lookup returns the currency with code, enabled or not
+func Lookup(code string) (Currency, bool) {
+	c, ok := byCode[code]
+	return c, ok
+}
+
+// IsSupported reports whether code may be used in new requests
+func IsSupported(code string) bool {
+	return byCode[code].Enabled
+}
+
+// All returns every known currency in enum order
+func All() []Currency {
+	return append([]Currency(nil), registry...)
+}
+
+// Codes returns the enum labels in order
+func Codes() []string {
+	codes := make([]string, len(registry))
+	for i, c := range registry {
+		codes[i] = c.Code
+	}
+	return codes
+}
+
+// EnumSQL generates the statement creating the supported_currency enum
+func EnumSQL() string {
+	quoted := make([]string, len(registry))
+	for i, code := range Codes() {
+		quoted[i] = "'" + code + "'"
+	}
+	return "CREATE TYPE supported_currency AS ENUM (" + strings.Join(quoted, ", ") + ");\n"
+}
+
+// VerifyEnum checks the labels of the supported_currency enum against the
+// registry. Labels may be in any order.
+func VerifyEnum(labels []string) error {
+	inEnum := make(map[string]bool, len(labels))
+	var unknown, missing []string
+	for _, label := range labels {
+		inEnum[label] = true
+		if _, ok := byCode[label]; !ok {
+			unknown = append(unknown, label)
+		}
+	}
+	for _, c := range registry {
+		if !inEnum[c.Code] {
+			missing = append(missing, c.Code)
+		}
+	}
+
+	if len(unknown) == 0 && len(missing) == 0 {
+		return nil
+	}
+	return fmt.Errorf("currency: supported_currency enum is out of date (missing %v, unknown %v)", missing, unknown)
+}
@@ -0,0 +1,20 @@
+package currency
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+// db_init.sql sets up a database without the migrations, so its enum has
+// to be the one EnumSQL prints
+func TestDBInitUsesRegistryEnum(t *testing.T) {
+	schema, err := os.ReadFile("../db_init.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	enum := strings.TrimSpace(EnumSQL())
+	if !strings.Contains(string(schema), enum) {
+		t.Fatalf("db_init.sql does not create the registry's enum, want:\n%s", enum)
+	}
+}
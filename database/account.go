@@ -0,0 +1,170 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"payment-server/model"
+	"payment-server/money"
+	"payment-server/utils"
+	"time"
+)
+
+const accountColumns = `id, user_id, balance, currency, status, type, name, description, metadata, created_at, updated_at`
+
+func (db *Database) CreateAccount(ctx context.Context, account *model.Account) error {
+	return insertAccount(ctx, db.db, account)
+}
+
+func insertAccount(ctx context.Context, exec execer, account *model.Account) error {
+	query := `
+		INSERT INTO accounts (id, user_id, balance, currency, status, type, name, description, metadata, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), NULLIF($8, ''), $9, $10, $11)`
+
+	_, err := exec.ExecContext(ctx, query,
+		account.ID,
+		account.UserID,
+		account.Balance.Amount,
+		account.Currency,
+		account.Status,
+		account.Kind,
+		account.Name,
+		account.Description,
+		nullableJSON(account.Metadata),
+		account.CreatedAt,
+		account.UpdatedAt,
+	)
+	return err
+}
+
+func (db *Database) GetAccountByID(ctx context.Context, id string) (*model.Account, error) {
+	if !isUUID(id) {
+		return nil, nil
+	}
+	query := `SELECT ` + accountColumns + ` FROM accounts WHERE id = $1`
+	account, err := scanAccount(db.db.QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return account, err
+}
+
+func (db *Database) ListAccounts(ctx context.Context, userID, status string) ([]model.Account, error) {
+	query := `SELECT ` + accountColumns + ` FROM accounts
+		WHERE user_id = $1 AND ($2 = '' OR status::text = $2)
+		ORDER BY created_at`
+	rows, err := db.db.QueryContext(ctx, query, userID, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	accounts := []model.Account{}
+	for rows.Next() {
+		account, err := scanAccount(rows)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, *account)
+	}
+	return accounts, rows.Err()
+}
+
+func (db *Database) GetClearingAccount(ctx context.Context, currency string) (*model.Account, error) {
+	// A unique index on the system user's currencies makes concurrent
+	// first deposits open a single account
+	account := newClearingAccount(currency, time.Now())
+	_, err := db.db.ExecContext(ctx, `
+		INSERT INTO accounts (id, user_id, balance, currency, status, type, name, created_at, updated_at)
+		VALUES ($1, $2, 0, $3, $4, $5, $6, $7, $7)
+		ON CONFLICT (currency) WHERE user_id = '00000000-0000-0000-0000-000000000000' DO NOTHING`,
+		account.ID,
+		account.UserID,
+		account.Currency,
+		account.Status,
+		account.Kind,
+		account.Name,
+		account.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT ` + accountColumns + ` FROM accounts WHERE user_id = $1 AND currency = $2`
+	return scanAccount(db.db.QueryRowContext(ctx, query, model.SystemUserID, currency))
+}
+
+// newClearingAccount is the clearing account opened for currency
+func newClearingAccount(currency string, now time.Time) *model.Account {
+	return &model.Account{
+		ID:        utils.GenerateID(),
+		UserID:    model.SystemUserID,
+		Balance:   money.Money{Currency: currency},
+		Currency:  currency,
+		Status:    model.AccountActive,
+		Kind:      model.AccountClearing,
+		Name:      currency + " clearing",
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+func (db *Database) UpdateAccountDetails(ctx context.Context, account *model.Account) error {
+	result, err := db.db.ExecContext(ctx, `
+		UPDATE accounts
+		SET name = NULLIF($1, ''), description = NULLIF($2, ''), metadata = $3, updated_at = $4
+		WHERE id = $5`,
+		account.Name,
+		account.Description,
+		nullableJSON(account.Metadata),
+		account.UpdatedAt,
+		account.ID,
+	)
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return ErrAccountNotFound
+	}
+	return nil
+}
+
+func scanAccount(row rowScanner) (*model.Account, error) {
+	account := &model.Account{}
+	var name, description sql.NullString
+	var metadata []byte
+	err := row.Scan(
+		&account.ID,
+		&account.UserID,
+		&account.Balance.Amount,
+		&account.Currency,
+		&account.Status,
+		&account.Kind,
+		&name,
+		&description,
+		&metadata,
+		&account.CreatedAt,
+		&account.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	account.Balance.Currency = account.Currency
+	account.Name = name.String
+	account.Description = description.String
+	if len(metadata) > 0 {
+		account.Metadata = metadata
+	}
+	return account, nil
+}
+
+// nullableJSON stores an empty document as SQL NULL
+func nullableJSON(doc []byte) interface{} {
+	if len(doc) == 0 {
+		return nil
+	}
+	return doc
+}
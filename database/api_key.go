@@ -0,0 +1,90 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"payment-server/model"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const apiKeyColumns = `id, merchant_id, name, prefix, key_hash, scopes, created_at, revoked_at`
+
+func (db *Database) CreateAPIKey(ctx context.Context, key *model.APIKey) error {
+	_, err := db.db.ExecContext(ctx, `
+		INSERT INTO api_keys (id, merchant_id, name, prefix, key_hash, scopes, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		key.ID, key.MerchantID, key.Name, key.Prefix, key.KeyHash, pq.Array(key.Scopes), key.CreatedAt,
+	)
+	return err
+}
+
+func (db *Database) GetAPIKeyByPrefix(ctx context.Context, prefix string) (*model.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE prefix = $1`
+	key, err := scanAPIKey(db.db.QueryRowContext(ctx, query, prefix))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return key, err
+}
+
+func (db *Database) ListAPIKeys(ctx context.Context, merchantID string) ([]model.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE merchant_id = $1 ORDER BY created_at DESC`
+	rows, err := db.db.QueryContext(ctx, query, merchantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []model.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+	return keys, rows.Err()
+}
+
+func (db *Database) RevokeAPIKey(ctx context.Context, merchantID, id string, at time.Time) error {
+	result, err := db.db.ExecContext(ctx, `
+		UPDATE api_keys SET revoked_at = $1
+		WHERE id = $2 AND merchant_id = $3 AND revoked_at IS NULL`,
+		at, id, merchantID,
+	)
+	if err != nil {
+		return err
+	}
+	revoked, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if revoked == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+func scanAPIKey(row rowScanner) (*model.APIKey, error) {
+	key := &model.APIKey{}
+	var revokedAt sql.NullTime
+	err := row.Scan(
+		&key.ID,
+		&key.MerchantID,
+		&key.Name,
+		&key.Prefix,
+		&key.KeyHash,
+		pq.Array(&key.Scopes),
+		&key.CreatedAt,
+		&revokedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if revokedAt.Valid {
+		key.RevokedAt = &revokedAt.Time
+	}
+	return key, nil
+}
@@ -0,0 +1,24 @@
+package database
+
+import (
+	"context"
+	"payment-server/model"
+)
+
+func (db *Database) CreateAuditLog(ctx context.Context, entry *model.AuditLog) error {
+	_, err := db.db.ExecContext(ctx, `
+		INSERT INTO audit_logs (id, entity_type, entity_id, action, actor_id, actor_type, changes, ip_address, user_agent, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, '')::INET, $9, $10)`,
+		entry.ID,
+		entry.EntityType,
+		entry.EntityID,
+		entry.Action,
+		entry.ActorID,
+		entry.ActorType,
+		[]byte(entry.Changes),
+		entry.IPAddress,
+		entry.UserAgent,
+		entry.CreatedAt,
+	)
+	return err
+}
@@ -0,0 +1,73 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"payment-server/model"
+)
+
+func (db *Database) ReserveIdempotencyKey(ctx context.Context, record *model.IdempotencyRecord) (*model.IdempotencyRecord, error) {
+	// Expired keys can be reused, so drop a stale reservation first
+	_, err := db.db.ExecContext(ctx, `
+		DELETE FROM idempotency_keys
+		WHERE client_id = $1 AND idempotency_key = $2 AND expires_at <= $3`,
+		record.ClientID, record.Key, record.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := db.db.ExecContext(ctx, `
+		INSERT INTO idempotency_keys (client_id, idempotency_key, fingerprint, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (client_id, idempotency_key) DO NOTHING`,
+		record.ClientID, record.Key, record.Fingerprint, record.CreatedAt, record.ExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if inserted, err := result.RowsAffected(); err != nil || inserted == 1 {
+		return nil, err
+	}
+
+	existing := &model.IdempotencyRecord{}
+	var statusCode sql.NullInt64
+	err = db.db.QueryRowContext(ctx, `
+		SELECT client_id, idempotency_key, fingerprint, status_code, response_body, created_at, expires_at
+		FROM idempotency_keys
+		WHERE client_id = $1 AND idempotency_key = $2`,
+		record.ClientID, record.Key,
+	).Scan(
+		&existing.ClientID,
+		&existing.Key,
+		&existing.Fingerprint,
+		&statusCode,
+		&existing.Body,
+		&existing.CreatedAt,
+		&existing.ExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	existing.StatusCode = int(statusCode.Int64)
+	return existing, nil
+}
+
+func (db *Database) SaveIdempotencyResponse(ctx context.Context, clientID, key string, statusCode int, body []byte) error {
+	_, err := db.db.ExecContext(ctx, `
+		UPDATE idempotency_keys
+		SET status_code = $1, response_body = $2
+		WHERE client_id = $3 AND idempotency_key = $4`,
+		statusCode, body, clientID, key,
+	)
+	return err
+}
+
+func (db *Database) ReleaseIdempotencyKey(ctx context.Context, clientID, key string) error {
+	_, err := db.db.ExecContext(ctx, `
+		DELETE FROM idempotency_keys
+		WHERE client_id = $1 AND idempotency_key = $2`,
+		clientID, key,
+	)
+	return err
+}
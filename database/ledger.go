@@ -0,0 +1,292 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"payment-server/ledger"
+	"payment-server/model"
+	"payment-server/money"
+	"payment-server/utils"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ledgerAccount is the locked state of an account while an entry is posted
+type ledgerAccount struct {
+	balance  int64
+	currency string
+	status   string
+	clearing bool
+	debited  bool
+	credited bool
+
+	// Outgoing transfers of the entry and the running totals they count
+	// towards. limits is nil when none are set for the account type.
+	outgoing     int64
+	largestDebit int64
+	dailySum     int64
+	monthlySum   int64
+	lastTransfer *time.Time
+	limits       *model.AccountLimits
+}
+
+func (db *Database) PostEntry(ctx context.Context, entry *ledger.Entry) ([]ledger.Posting, error) {
+	tx, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	postings, err := postEntry(ctx, tx, entry)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return postings, nil
+}
+
+// postEntry applies entry within tx
+func postEntry(ctx context.Context, tx *sql.Tx, entry *ledger.Entry) ([]ledger.Posting, error) {
+	// Lock in a fixed order so that concurrent entries cannot deadlock
+	ids := entryAccountIDs(entry)
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, balance, currency, status, type,
+			COALESCE(daily_transfers_sum, 0), COALESCE(monthly_transfers_sum, 0), last_transfer_date
+		FROM accounts
+		WHERE id = ANY($1)
+		ORDER BY id
+		FOR UPDATE`,
+		pq.Array(ids),
+	)
+	if err != nil {
+		return nil, err
+	}
+	accounts := make(map[string]*ledgerAccount, len(ids))
+	kinds := make(map[string]string, len(ids))
+	for rows.Next() {
+		var id, kind string
+		var lastTransfer sql.NullTime
+		account := &ledgerAccount{}
+		err := rows.Scan(&id, &account.balance, &account.currency, &account.status, &kind,
+			&account.dailySum, &account.monthlySum, &lastTransfer)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if lastTransfer.Valid {
+			account.lastTransfer = &lastTransfer.Time
+		}
+		account.clearing = kind == model.AccountClearing
+		accounts[id] = account
+		kinds[id] = kind
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for id, account := range accounts {
+		account.limits, err = getAccountLimits(ctx, tx, kinds[id], account.currency)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	postings, err := applyEntry(entry, accounts)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range ids {
+		account := accounts[id]
+		_, err = tx.ExecContext(ctx, `
+			UPDATE accounts
+			SET balance = $1, daily_transfers_sum = $2, monthly_transfers_sum = $3, last_transfer_date = $4, updated_at = $5
+			WHERE id = $6`,
+			account.balance, account.dailySum, account.monthlySum, account.lastTransfer, entry.CreatedAt, id)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, posting := range postings {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO transactions (id, journal_id, account_id, payment_id, type, amount, balance_after, currency, description, created_at)
+			VALUES ($1, $2, $3, NULLIF($4, '')::UUID, $5, $6, $7, $8, NULLIF($9, ''), $10)`,
+			posting.ID,
+			posting.JournalID,
+			posting.AccountID,
+			posting.PaymentID,
+			posting.Type,
+			posting.Amount,
+			posting.BalanceAfter,
+			posting.Currency,
+			posting.Description,
+			posting.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return postings, nil
+}
+
+func (db *Database) LedgerTotals(ctx context.Context) (map[string]int64, error) {
+	rows, err := db.db.QueryContext(ctx, `SELECT currency, SUM(amount) FROM transactions GROUP BY currency`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	totals := make(map[string]int64)
+	for rows.Next() {
+		var currency string
+		var total int64
+		if err := rows.Scan(&currency, &total); err != nil {
+			return nil, err
+		}
+		totals[currency] = total
+	}
+	return totals, rows.Err()
+}
+
+func (db *Database) LedgerDrift(ctx context.Context) ([]ledger.Drift, error) {
+	rows, err := db.db.QueryContext(ctx, `
+		SELECT a.id, a.balance, COALESCE(SUM(t.amount), 0)
+		FROM accounts a
+		LEFT JOIN transactions t ON t.account_id = a.id
+		GROUP BY a.id, a.balance
+		HAVING a.balance <> COALESCE(SUM(t.amount), 0)
+		ORDER BY a.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	drifts := []ledger.Drift{}
+	for rows.Next() {
+		var drift ledger.Drift
+		if err := rows.Scan(&drift.AccountID, &drift.Balance, &drift.Posted); err != nil {
+			return nil, err
+		}
+		drifts = append(drifts, drift)
+	}
+	return drifts, rows.Err()
+}
+
+// entryAccountIDs returns the distinct accounts of entry, sorted
+func entryAccountIDs(entry *ledger.Entry) []string {
+	seen := make(map[string]bool)
+	ids := []string{}
+	for _, line := range entry.Lines {
+		if !seen[line.AccountID] {
+			seen[line.AccountID] = true
+			ids = append(ids, line.AccountID)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// applyEntry checks entry against the locked accounts and moves their
+// balances, returning the postings to store. Shared by both stores.
+func applyEntry(entry *ledger.Entry, accounts map[string]*ledgerAccount) ([]ledger.Posting, error) {
+	postings := make([]ledger.Posting, 0, len(entry.Lines))
+	for _, line := range entry.Lines {
+		account, ok := accounts[line.AccountID]
+		if !ok {
+			return nil, ledger.ErrUnknownAccount
+		}
+		if account.currency != entry.Currency {
+			return nil, ledger.ErrCurrencyMismatch
+		}
+		if account.status != model.AccountActive {
+			return nil, ledger.ErrAccountNotActive
+		}
+
+		balance, err := money.Money{Amount: account.balance, Currency: entry.Currency}.Add(money.Money{Amount: line.Amount, Currency: entry.Currency})
+		if err != nil {
+			return nil, ledger.ErrOverflow
+		}
+		account.balance = balance.Amount
+		account.debited = account.debited || line.Amount < 0
+		account.credited = account.credited || line.Amount > 0
+		if line.Type == ledger.Debit {
+			account.outgoing -= line.Amount
+			if -line.Amount > account.largestDebit {
+				account.largestDebit = -line.Amount
+			}
+		}
+		postings = append(postings, ledger.Posting{
+			ID:           utils.GenerateID(),
+			JournalID:    entry.ID,
+			AccountID:    line.AccountID,
+			PaymentID:    entry.PaymentID,
+			Type:         line.Type,
+			Amount:       line.Amount,
+			BalanceAfter: account.balance,
+			Currency:     entry.Currency,
+			Description:  line.Description,
+			CreatedAt:    entry.CreatedAt,
+		})
+	}
+
+	// Accounts only need to cover what the entry takes out of them. Clearing
+	// accounts stand for money outside the ledger and go negative.
+	for _, id := range entryAccountIDs(entry) {
+		account := accounts[id]
+		if account.clearing {
+			continue
+		}
+		if account.debited && account.balance < 0 && (account.limits == nil || account.limits.MinBalance.Amount >= 0) {
+			return nil, ledger.ErrInsufficientFunds
+		}
+		if err := checkLimits(id, account, entry.CreatedAt); err != nil {
+			return nil, err
+		}
+	}
+	return postings, nil
+}
+
+// checkLimits holds account to its limits after the entry and adds the
+// outgoing transfers of the entry to its daily and monthly totals. The
+// totals start over on the first transfer of a UTC day or month.
+func checkLimits(id string, account *ledgerAccount, at time.Time) error {
+	limits := account.limits
+	if account.outgoing > 0 {
+		today := at.UTC().Truncate(24 * time.Hour)
+		if last := account.lastTransfer; last == nil || last.Year() != today.Year() || last.Month() != today.Month() {
+			account.dailySum, account.monthlySum = 0, 0
+		} else if last.Day() != today.Day() {
+			account.dailySum = 0
+		}
+		account.dailySum += account.outgoing
+		account.monthlySum += account.outgoing
+		account.lastTransfer = &today
+	}
+	if limits == nil {
+		return nil
+	}
+
+	exceeded := func(code string, limit, attempted int64) error {
+		return &ledger.LimitError{AccountID: id, Code: code, Limit: limit, Attempted: attempted}
+	}
+	switch {
+	case account.debited && account.balance < limits.MinBalance.Amount:
+		return exceeded(ledger.MinBalanceBreached, limits.MinBalance.Amount, account.balance)
+	case account.credited && limits.MaxBalance != nil && account.balance > limits.MaxBalance.Amount:
+		return exceeded(ledger.MaxBalanceExceeded, limits.MaxBalance.Amount, account.balance)
+	case account.outgoing == 0:
+		return nil
+	case account.largestDebit > limits.SingleTransferLimit.Amount:
+		return exceeded(ledger.SingleTransferLimitExceeded, limits.SingleTransferLimit.Amount, account.largestDebit)
+	case account.dailySum > limits.DailyTransferLimit.Amount:
+		return exceeded(ledger.DailyTransferLimitExceeded, limits.DailyTransferLimit.Amount, account.dailySum)
+	case account.monthlySum > limits.MonthlyTransferLimit.Amount:
+		return exceeded(ledger.MonthlyTransferLimitExceeded, limits.MonthlyTransferLimit.Amount, account.monthlySum)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"payment-server/model"
+	"payment-server/money"
+)
+
+const limitsColumns = `id, account_type, currency, single_transfer_limit, daily_transfer_limit, monthly_transfer_limit, min_balance, max_balance, created_at, updated_at`
+
+func (db *Database) ListAccountLimits(ctx context.Context) ([]model.AccountLimits, error) {
+	rows, err := db.db.QueryContext(ctx, `SELECT `+limitsColumns+` FROM account_limits ORDER BY account_type, currency`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	limits := []model.AccountLimits{}
+	for rows.Next() {
+		l, err := scanAccountLimits(rows)
+		if err != nil {
+			return nil, err
+		}
+		limits = append(limits, *l)
+	}
+	return limits, rows.Err()
+}
+
+func (db *Database) UpsertAccountLimits(ctx context.Context, limits *model.AccountLimits) error {
+	// The existing row keeps its ID and creation time
+	return db.db.QueryRowContext(ctx, `
+		INSERT INTO account_limits (id, account_type, currency, single_transfer_limit, daily_transfer_limit, monthly_transfer_limit, min_balance, max_balance, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (account_type, currency) DO UPDATE SET
+			single_transfer_limit = EXCLUDED.single_transfer_limit,
+			daily_transfer_limit = EXCLUDED.daily_transfer_limit,
+			monthly_transfer_limit = EXCLUDED.monthly_transfer_limit,
+			min_balance = EXCLUDED.min_balance,
+			max_balance = EXCLUDED.max_balance,
+			updated_at = EXCLUDED.updated_at
+		RETURNING id, created_at`,
+		limits.ID,
+		limits.AccountType,
+		limits.Currency,
+		limits.SingleTransferLimit.Amount,
+		limits.DailyTransferLimit.Amount,
+		limits.MonthlyTransferLimit.Amount,
+		limits.MinBalance.Amount,
+		maxBalance(limits),
+		limits.CreatedAt,
+		limits.UpdatedAt,
+	).Scan(&limits.ID, &limits.CreatedAt)
+}
+
+// maxBalance stores an unbounded balance as SQL NULL
+func maxBalance(limits *model.AccountLimits) interface{} {
+	if limits.MaxBalance == nil {
+		return nil
+	}
+	return limits.MaxBalance.Amount
+}
+
+type rowQueryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// getAccountLimits returns nil when no limits are set for the account type
+// and currency
+func getAccountLimits(ctx context.Context, q rowQueryer, accountType, currency string) (*model.AccountLimits, error) {
+	limits, err := scanAccountLimits(q.QueryRowContext(ctx,
+		`SELECT `+limitsColumns+` FROM account_limits WHERE account_type = $1 AND currency = $2`,
+		accountType, currency))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return limits, err
+}
+
+func scanAccountLimits(row rowScanner) (*model.AccountLimits, error) {
+	limits := &model.AccountLimits{}
+	var maxBalance sql.NullInt64
+	err := row.Scan(
+		&limits.ID,
+		&limits.AccountType,
+		&limits.Currency,
+		&limits.SingleTransferLimit.Amount,
+		&limits.DailyTransferLimit.Amount,
+		&limits.MonthlyTransferLimit.Amount,
+		&limits.MinBalance.Amount,
+		&maxBalance,
+		&limits.CreatedAt,
+		&limits.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	limits.SingleTransferLimit.Currency = limits.Currency
+	limits.DailyTransferLimit.Currency = limits.Currency
+	limits.MonthlyTransferLimit.Currency = limits.Currency
+	limits.MinBalance.Currency = limits.Currency
+	if maxBalance.Valid {
+		limits.MaxBalance = &money.Money{Amount: maxBalance.Int64, Currency: limits.Currency}
+	}
+	return limits, nil
+}
@@ -0,0 +1,808 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"payment-server/ledger"
+	"payment-server/model"
+	"payment-server/utils"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a concurrency-safe Store that keeps all data in memory.
+// It is meant for unit tests and local demos that run without Postgres.
+type MemoryStore struct {
+	mu           sync.RWMutex
+	transactions map[string]model.Transaction
+	users        map[string]model.User
+	usernames    map[string]string
+	accounts     map[string]model.Account
+	idempotency  map[idempotencyID]model.IdempotencyRecord
+	webhooks     map[string]model.WebhookEvent
+	deliveries   map[string][]model.WebhookAttempt
+	secrets      map[string][]model.WebhookSecret
+	refresh      map[string]model.RefreshToken
+	apiKeys      map[string]model.APIKey
+	auditLogs    []model.AuditLog
+	postings     []ledger.Posting
+	transfers    map[string]model.Transfer
+	limits       map[limitsID]model.AccountLimits
+	hosts        map[string][]model.CallbackHost
+}
+
+// idempotencyID scopes an Idempotency-Key to the client that sent it
+type idempotencyID struct {
+	clientID string
+	key      string
+}
+
+// limitsID mirrors the unique (account_type, currency) of account_limits
+type limitsID struct {
+	accountType string
+	currency    string
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		transactions: make(map[string]model.Transaction),
+		users:        make(map[string]model.User),
+		usernames:    make(map[string]string),
+		accounts:     make(map[string]model.Account),
+		idempotency:  make(map[idempotencyID]model.IdempotencyRecord),
+		webhooks:     make(map[string]model.WebhookEvent),
+		deliveries:   make(map[string][]model.WebhookAttempt),
+		secrets:      make(map[string][]model.WebhookSecret),
+		refresh:      make(map[string]model.RefreshToken),
+		apiKeys:      make(map[string]model.APIKey),
+		transfers:    make(map[string]model.Transfer),
+		limits:       make(map[limitsID]model.AccountLimits),
+		hosts:        make(map[string][]model.CallbackHost),
+	}
+}
+
+func (m *MemoryStore) SaveTransaction(transaction *model.Transaction) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.transactions[transaction.ID]; exists {
+		return fmt.Errorf("transaction with ID %s already exists", transaction.ID)
+	}
+	m.transactions[transaction.ID] = *transaction
+	return nil
+}
+
+func (m *MemoryStore) GetTransactionByID(id string) (*model.Transaction, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	transaction, ok := m.transactions[id]
+	if !ok {
+		return nil, nil
+	}
+	return &transaction, nil
+}
+
+func (m *MemoryStore) UpdateTransactionStatus(id, from, to string) (*model.Transaction, error) {
+	if err := model.ValidateTransition(from, to); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	transaction, ok := m.transactions[id]
+	if !ok {
+		return nil, model.ErrTransactionNotFound
+	}
+	if transaction.Status != from {
+		return nil, model.ErrStatusConflict
+	}
+	transaction.Status = to
+	transaction.UpdatedAt = time.Now()
+	if err := m.enqueueWebhook(transaction); err != nil {
+		return nil, err
+	}
+	m.transactions[id] = transaction
+	return &transaction, nil
+}
+
+func (m *MemoryStore) CancelTransaction(id, from, reason string) (*model.Transaction, error) {
+	if err := model.ValidateTransition(from, model.StatusCancelled); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	transaction, ok := m.transactions[id]
+	if !ok {
+		return nil, model.ErrTransactionNotFound
+	}
+	if transaction.Status != from {
+		return nil, model.ErrStatusConflict
+	}
+	transaction.Status = model.StatusCancelled
+	transaction.CancellationReason = reason
+	transaction.UpdatedAt = time.Now()
+	if err := m.enqueueWebhook(transaction); err != nil {
+		return nil, err
+	}
+	m.transactions[id] = transaction
+	return &transaction, nil
+}
+
+func (m *MemoryStore) SetProviderReference(id, reference string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	transaction, ok := m.transactions[id]
+	if !ok {
+		return model.ErrTransactionNotFound
+	}
+	transaction.ProviderReference = reference
+	transaction.UpdatedAt = time.Now()
+	m.transactions[id] = transaction
+	return nil
+}
+
+func (m *MemoryStore) GetTransactionByProviderReference(provider, reference string) (*model.Transaction, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, transaction := range m.transactions {
+		if transaction.Provider == provider && transaction.ProviderReference == reference {
+			return &transaction, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *MemoryStore) ListTransactionsToReconcile(ctx context.Context, createdBefore, now time.Time, limit int) ([]model.Transaction, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var transactions []model.Transaction
+	for _, transaction := range m.transactions {
+		if transaction.Status != model.StatusPending && transaction.Status != model.StatusProcessing {
+			continue
+		}
+		if transaction.ProviderReference == "" || !transaction.CreatedAt.Before(createdBefore) {
+			continue
+		}
+		if transaction.NextStatusQueryAt != nil && transaction.NextStatusQueryAt.After(now) {
+			continue
+		}
+		transactions = append(transactions, transaction)
+	}
+	sort.Slice(transactions, func(i, j int) bool {
+		return reconcileOrder(transactions[i]).Before(reconcileOrder(transactions[j]))
+	})
+	if len(transactions) > limit {
+		transactions = transactions[:limit]
+	}
+	return transactions, nil
+}
+
+// reconcileOrder is the time a transaction became due for a status query
+func reconcileOrder(transaction model.Transaction) time.Time {
+	if transaction.NextStatusQueryAt != nil {
+		return *transaction.NextStatusQueryAt
+	}
+	return transaction.CreatedAt
+}
+
+func (m *MemoryStore) ScheduleStatusQuery(ctx context.Context, id string, queries int, next time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	transaction, ok := m.transactions[id]
+	if !ok {
+		return model.ErrTransactionNotFound
+	}
+	transaction.StatusQueries = queries
+	transaction.NextStatusQueryAt = &next
+	m.transactions[id] = transaction
+	return nil
+}
+
+func (m *MemoryStore) ListExpiredTransactions(ctx context.Context, before time.Time, limit int) ([]model.Transaction, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var transactions []model.Transaction
+	for _, transaction := range m.transactions {
+		unsettled := transaction.Status == model.StatusPending || transaction.Status == model.StatusProcessing
+		if unsettled && transaction.ExpiresAt.Before(before) {
+			transactions = append(transactions, transaction)
+		}
+	}
+	sort.Slice(transactions, func(i, j int) bool {
+		return transactions[i].ExpiresAt.Before(transactions[j].ExpiresAt)
+	})
+	if len(transactions) > limit {
+		transactions = transactions[:limit]
+	}
+	return transactions, nil
+}
+
+func (m *MemoryStore) CheckUsernameExists(ctx context.Context, username string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	_, exists := m.usernames[username]
+	return exists, nil
+}
+
+func (m *MemoryStore) CreateUser(ctx context.Context, user *model.User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.usernames[user.Username]; exists {
+		return ErrUsernameTaken
+	}
+	for _, account := range user.Accounts {
+		if _, exists := m.accounts[account.ID]; exists {
+			return fmt.Errorf("account with ID %s already exists", account.ID)
+		}
+	}
+
+	stored := *user
+	stored.Accounts = nil
+	m.users[user.ID] = stored
+	m.usernames[user.Username] = user.ID
+	for _, account := range user.Accounts {
+		m.accounts[account.ID] = account
+	}
+	return nil
+}
+
+func (m *MemoryStore) CreateAccount(ctx context.Context, account *model.Account) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[account.UserID]; !ok {
+		return fmt.Errorf("user with ID %s not found", account.UserID)
+	}
+	if _, exists := m.accounts[account.ID]; exists {
+		return fmt.Errorf("account with ID %s already exists", account.ID)
+	}
+	m.accounts[account.ID] = *account
+	return nil
+}
+
+func (m *MemoryStore) GetUserByUsername(ctx context.Context, username string) (*model.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	id, ok := m.usernames[username]
+	if !ok {
+		return nil, nil
+	}
+	user := m.users[id]
+	return &user, nil
+}
+
+func (m *MemoryStore) GetUserByID(ctx context.Context, id string) (*model.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.users[id]
+	if !ok {
+		return nil, nil
+	}
+	return &user, nil
+}
+
+func (m *MemoryStore) UpdateLastLogin(ctx context.Context, userID string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return fmt.Errorf("user with ID %s not found", userID)
+	}
+	user.LastLoginAt = &at
+	m.users[userID] = user
+	return nil
+}
+
+func (m *MemoryStore) UpdateUserRole(ctx context.Context, userID, role string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return ErrUserNotFound
+	}
+	user.Role = role
+	m.users[userID] = user
+	return nil
+}
+
+func (m *MemoryStore) CreateAuditLog(ctx context.Context, entry *model.AuditLog) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.auditLogs = append(m.auditLogs, *entry)
+	return nil
+}
+
+func (m *MemoryStore) CreateRefreshToken(ctx context.Context, token *model.RefreshToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.refresh[token.TokenHash] = *token
+	return nil
+}
+
+func (m *MemoryStore) GetRefreshToken(ctx context.Context, tokenHash string) (*model.RefreshToken, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	token, ok := m.refresh[tokenHash]
+	if !ok {
+		return nil, nil
+	}
+	return &token, nil
+}
+
+func (m *MemoryStore) RotateRefreshToken(ctx context.Context, oldID string, next *model.RefreshToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for hash, token := range m.refresh {
+		if token.ID != oldID {
+			continue
+		}
+		if token.RevokedAt != nil {
+			return ErrRefreshTokenReused
+		}
+		revokedAt := next.CreatedAt
+		token.RevokedAt = &revokedAt
+		token.ReplacedBy = next.ID
+		m.refresh[hash] = token
+		m.refresh[next.TokenHash] = *next
+		return nil
+	}
+	return fmt.Errorf("refresh token with ID %s not found", oldID)
+}
+
+func (m *MemoryStore) RevokeRefreshTokenFamily(ctx context.Context, familyID string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for hash, token := range m.refresh {
+		if token.FamilyID == familyID && token.RevokedAt == nil {
+			revokedAt := at
+			token.RevokedAt = &revokedAt
+			m.refresh[hash] = token
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) CreateAPIKey(ctx context.Context, key *model.APIKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.apiKeys[key.Prefix]; exists {
+		return fmt.Errorf("api key with prefix %s already exists", key.Prefix)
+	}
+	stored := *key
+	stored.Key = ""
+	stored.Scopes = append([]string(nil), key.Scopes...)
+	m.apiKeys[key.Prefix] = stored
+	return nil
+}
+
+func (m *MemoryStore) GetAPIKeyByPrefix(ctx context.Context, prefix string) (*model.APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	key, ok := m.apiKeys[prefix]
+	if !ok {
+		return nil, nil
+	}
+	return &key, nil
+}
+
+func (m *MemoryStore) ListAPIKeys(ctx context.Context, merchantID string) ([]model.APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	keys := []model.APIKey{}
+	for _, key := range m.apiKeys {
+		if key.MerchantID == merchantID {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.After(keys[j].CreatedAt)
+	})
+	return keys, nil
+}
+
+func (m *MemoryStore) RevokeAPIKey(ctx context.Context, merchantID, id string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for prefix, key := range m.apiKeys {
+		if key.ID == id && key.MerchantID == merchantID && key.RevokedAt == nil {
+			key.RevokedAt = &at
+			m.apiKeys[prefix] = key
+			return nil
+		}
+	}
+	return ErrAPIKeyNotFound
+}
+
+func (m *MemoryStore) GetAccountByID(ctx context.Context, id string) (*model.Account, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	account, ok := m.accounts[id]
+	if !ok {
+		return nil, nil
+	}
+	return &account, nil
+}
+
+func (m *MemoryStore) GetClearingAccount(ctx context.Context, currency string) (*model.Account, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, account := range m.accounts {
+		if account.Kind == model.AccountClearing && account.Currency == currency {
+			return &account, nil
+		}
+	}
+	account := newClearingAccount(currency, time.Now())
+	m.accounts[account.ID] = *account
+	return account, nil
+}
+
+func (m *MemoryStore) ListAccounts(ctx context.Context, userID, status string) ([]model.Account, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	accounts := []model.Account{}
+	for _, account := range m.accounts {
+		if account.UserID == userID && (status == "" || account.Status == status) {
+			accounts = append(accounts, account)
+		}
+	}
+	sort.Slice(accounts, func(i, j int) bool {
+		return accounts[i].CreatedAt.Before(accounts[j].CreatedAt)
+	})
+	return accounts, nil
+}
+
+func (m *MemoryStore) UpdateAccountDetails(ctx context.Context, account *model.Account) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.accounts[account.ID]
+	if !ok {
+		return ErrAccountNotFound
+	}
+	stored.Name = account.Name
+	stored.Description = account.Description
+	stored.Metadata = account.Metadata
+	stored.UpdatedAt = account.UpdatedAt
+	m.accounts[account.ID] = stored
+	return nil
+}
+
+func (m *MemoryStore) PostEntry(ctx context.Context, entry *ledger.Entry) ([]ledger.Posting, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.postEntry(entry)
+}
+
+// postEntry must be called with m.mu held
+func (m *MemoryStore) postEntry(entry *ledger.Entry) ([]ledger.Posting, error) {
+	accounts := make(map[string]*ledgerAccount)
+	for _, id := range entryAccountIDs(entry) {
+		if account, ok := m.accounts[id]; ok {
+			accounts[id] = &ledgerAccount{
+				balance:      account.Balance.Amount,
+				currency:     account.Currency,
+				status:       account.Status,
+				clearing:     account.Kind == model.AccountClearing,
+				dailySum:     account.DailyTransfersSum,
+				monthlySum:   account.MonthlyTransfersSum,
+				lastTransfer: account.LastTransferDate,
+			}
+			if limits, ok := m.limits[limitsID{account.Kind, account.Currency}]; ok {
+				accounts[id].limits = &limits
+			}
+		}
+	}
+
+	postings, err := applyEntry(entry, accounts)
+	if err != nil {
+		return nil, err
+	}
+	for id, locked := range accounts {
+		account := m.accounts[id]
+		account.Balance.Amount = locked.balance
+		account.DailyTransfersSum = locked.dailySum
+		account.MonthlyTransfersSum = locked.monthlySum
+		account.LastTransferDate = locked.lastTransfer
+		account.UpdatedAt = entry.CreatedAt
+		m.accounts[id] = account
+	}
+	m.postings = append(m.postings, postings...)
+	return postings, nil
+}
+
+func (m *MemoryStore) ListAccountLimits(ctx context.Context) ([]model.AccountLimits, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	limits := make([]model.AccountLimits, 0, len(m.limits))
+	for _, l := range m.limits {
+		limits = append(limits, l)
+	}
+	sort.Slice(limits, func(i, j int) bool {
+		if limits[i].AccountType != limits[j].AccountType {
+			return limits[i].AccountType < limits[j].AccountType
+		}
+		return limits[i].Currency < limits[j].Currency
+	})
+	return limits, nil
+}
+
+func (m *MemoryStore) UpsertAccountLimits(ctx context.Context, limits *model.AccountLimits) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := limitsID{limits.AccountType, limits.Currency}
+	if existing, ok := m.limits[key]; ok {
+		limits.ID = existing.ID
+		limits.CreatedAt = existing.CreatedAt
+	}
+	m.limits[key] = *limits
+	return nil
+}
+
+func (m *MemoryStore) CreateTransfer(ctx context.Context, transfer *model.Transfer, entry *ledger.Entry) ([]ledger.Posting, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.transfers[transfer.ID]; exists {
+		return nil, fmt.Errorf("transfer with ID %s already exists", transfer.ID)
+	}
+	postings, err := m.postEntry(entry)
+	if err != nil {
+		return nil, err
+	}
+	m.transfers[transfer.ID] = *transfer
+	return postings, nil
+}
+
+func (m *MemoryStore) GetTransferByID(ctx context.Context, id string) (*model.Transfer, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	transfer, ok := m.transfers[id]
+	if !ok {
+		return nil, nil
+	}
+	return &transfer, nil
+}
+
+func (m *MemoryStore) LedgerTotals(ctx context.Context) (map[string]int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	totals := make(map[string]int64)
+	for _, posting := range m.postings {
+		totals[posting.Currency] += posting.Amount
+	}
+	return totals, nil
+}
+
+func (m *MemoryStore) LedgerDrift(ctx context.Context) ([]ledger.Drift, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	posted := make(map[string]int64)
+	for _, posting := range m.postings {
+		posted[posting.AccountID] += posting.Amount
+	}
+	drifts := []ledger.Drift{}
+	for id, account := range m.accounts {
+		if account.Balance.Amount != posted[id] {
+			drifts = append(drifts, ledger.Drift{AccountID: id, Balance: account.Balance.Amount, Posted: posted[id]})
+		}
+	}
+	sort.Slice(drifts, func(i, j int) bool {
+		return drifts[i].AccountID < drifts[j].AccountID
+	})
+	return drifts, nil
+}
+
+func (m *MemoryStore) ReserveIdempotencyKey(ctx context.Context, record *model.IdempotencyRecord) (*model.IdempotencyRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := idempotencyID{record.ClientID, record.Key}
+	if existing, ok := m.idempotency[id]; ok && existing.ExpiresAt.After(record.CreatedAt) {
+		return &existing, nil
+	}
+	m.idempotency[id] = *record
+	return nil, nil
+}
+
+func (m *MemoryStore) SaveIdempotencyResponse(ctx context.Context, clientID, key string, statusCode int, body []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := idempotencyID{clientID, key}
+	record, ok := m.idempotency[id]
+	if !ok {
+		return nil
+	}
+	record.StatusCode = statusCode
+	record.Body = append([]byte(nil), body...)
+	m.idempotency[id] = record
+	return nil
+}
+
+func (m *MemoryStore) ReleaseIdempotencyKey(ctx context.Context, clientID, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.idempotency, idempotencyID{clientID, key})
+	return nil
+}
+
+// enqueueWebhook must be called with m.mu held
+func (m *MemoryStore) enqueueWebhook(transaction model.Transaction) error {
+	if transaction.WebhookURL == "" {
+		return nil
+	}
+	event, err := model.NewPaymentUpdatedEvent(utils.GenerateID(), transaction)
+	if err != nil {
+		return err
+	}
+	m.webhooks[event.ID] = *event
+	return nil
+}
+
+func (m *MemoryStore) ClaimDueWebhookEvents(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]model.WebhookEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var events []model.WebhookEvent
+	for _, event := range m.webhooks {
+		if event.Status == model.WebhookPending && !event.NextAttemptAt.After(now) {
+			events = append(events, event)
+		}
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].NextAttemptAt.Before(events[j].NextAttemptAt)
+	})
+	if len(events) > limit {
+		events = events[:limit]
+	}
+
+	for i := range events {
+		events[i].NextAttemptAt = now.Add(lease)
+		m.webhooks[events[i].ID] = events[i]
+	}
+	return events, nil
+}
+
+func (m *MemoryStore) RecordWebhookAttempt(ctx context.Context, event *model.WebhookEvent, attempt *model.WebhookAttempt) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.webhooks[event.ID]; !ok {
+		return fmt.Errorf("webhook event with ID %s not found", event.ID)
+	}
+	stored := *event
+	stored.Deliveries = nil
+	stored.UpdatedAt = time.Now()
+	m.webhooks[event.ID] = stored
+	m.deliveries[event.ID] = append(m.deliveries[event.ID], *attempt)
+	return nil
+}
+
+func (m *MemoryStore) ListWebhookEvents(ctx context.Context, transactionID string) ([]model.WebhookEvent, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var events []model.WebhookEvent
+	for _, event := range m.webhooks {
+		if event.TransactionID == transactionID {
+			event.Deliveries = append([]model.WebhookAttempt(nil), m.deliveries[event.ID]...)
+			events = append(events, event)
+		}
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].CreatedAt.Before(events[j].CreatedAt)
+	})
+	return events, nil
+}
+
+func (m *MemoryStore) RotateWebhookSecret(ctx context.Context, secret *model.WebhookSecret, previousExpiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	active := activeSecrets(m.secrets[secret.MerchantID], secret.CreatedAt)
+	for i := range active {
+		expiresAt := secret.CreatedAt
+		if i == 0 && (active[i].ExpiresAt == nil || active[i].ExpiresAt.After(previousExpiresAt)) {
+			expiresAt = previousExpiresAt
+		}
+		active[i].ExpiresAt = &expiresAt
+	}
+	m.secrets[secret.MerchantID] = append([]model.WebhookSecret{*secret}, active...)
+	return nil
+}
+
+func (m *MemoryStore) ListActiveWebhookSecrets(ctx context.Context, merchantID string, now time.Time) ([]model.WebhookSecret, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return activeSecrets(m.secrets[merchantID], now), nil
+}
+
+// activeSecrets copies the unexpired secrets, which are kept newest first
+func activeSecrets(secrets []model.WebhookSecret, now time.Time) []model.WebhookSecret {
+	var active []model.WebhookSecret
+	for _, secret := range secrets {
+		if secret.ExpiresAt == nil || secret.ExpiresAt.After(now) {
+			active = append(active, secret)
+		}
+	}
+	return active
+}
+
+func (m *MemoryStore) AddCallbackHost(ctx context.Context, host *model.CallbackHost) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	hosts := m.hosts[host.MerchantID]
+	for _, existing := range hosts {
+		if existing.Host == host.Host {
+			*host = existing
+			return nil
+		}
+	}
+	hosts = append(hosts, *host)
+	sort.Slice(hosts, func(i, j int) bool { return hosts[i].Host < hosts[j].Host })
+	m.hosts[host.MerchantID] = hosts
+	return nil
+}
+
+func (m *MemoryStore) RemoveCallbackHost(ctx context.Context, merchantID, host string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	hosts := m.hosts[merchantID]
+	for i, existing := range hosts {
+		if existing.Host == host {
+			m.hosts[merchantID] = append(hosts[:i:i], hosts[i+1:]...)
+			return nil
+		}
+	}
+	return ErrCallbackHostNotFound
+}
+
+func (m *MemoryStore) ListCallbackHosts(ctx context.Context, merchantID string) ([]model.CallbackHost, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return append([]model.CallbackHost(nil), m.hosts[merchantID]...), nil
+}
+
+// Close is a no-op for the in-memory store
+func (m *MemoryStore) Close() error {
+	return nil
+}
@@ -0,0 +1,153 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"os"
+	"payment-server/config"
+	"payment-server/model"
+	"payment-server/money"
+	"payment-server/utils"
+	"testing"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+)
+
+// The Postgres tests run against the scratch database named by
+// TEST_DATABASE_URL, migrated up first, and are skipped without it. They
+// cover what MemoryStore cannot, such as triggers and constraints.
+func testDatabase(t *testing.T) *Database {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	m, err := migrate.New("file://../migrations", url)
+	if err != nil {
+		t.Fatalf("open migrations: %v", err)
+	}
+	if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		t.Fatalf("migrate up: %v", err)
+	}
+	m.Close()
+
+	db := NewDatabase(config.DatabaseConfig{URL: url, MaxOpenConns: 2, MaxIdleConns: 2})
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func newTestUser() *model.User {
+	now := time.Now()
+	user := &model.User{
+		ID:        utils.GenerateID(),
+		Username:  "user_" + utils.GenerateID(),
+		Password:  "!",
+		Role:      model.RoleCustomer,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	user.Accounts = []model.Account{{
+		ID:        utils.GenerateID(),
+		UserID:    user.ID,
+		Balance:   money.Money{Currency: "USD"},
+		Currency:  "USD",
+		Status:    model.AccountActive,
+		Kind:      model.AccountPersonal,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}}
+	return user
+}
+
+// auditActions lists the actions the audit trigger logged for an entity
+func auditActions(t *testing.T, db *Database, entityType, entityID string) []string {
+	t.Helper()
+	rows, err := db.db.Query(`
+		SELECT action FROM audit_logs
+		WHERE entity_type = $1 AND entity_id = $2 AND actor_id = $3 AND actor_type = 'system'
+		ORDER BY created_at`,
+		entityType, entityID, model.SystemUserID)
+	if err != nil {
+		t.Fatalf("query audit logs: %v", err)
+	}
+	defer rows.Close()
+
+	actions := []string{}
+	for rows.Next() {
+		var action string
+		if err := rows.Scan(&action); err != nil {
+			t.Fatalf("scan audit log: %v", err)
+		}
+		actions = append(actions, action)
+	}
+	return actions
+}
+
+func TestPostgresCreateUser(t *testing.T) {
+	db := testDatabase(t)
+	ctx := context.Background()
+
+	user := newTestUser()
+	if err := db.CreateUser(ctx, user); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	stored, err := db.GetUserByUsername(ctx, user.Username)
+	if err != nil || stored == nil || stored.ID != user.ID {
+		t.Fatalf("GetUserByUsername = %+v, %v; want user %s", stored, err, user.ID)
+	}
+	account, err := db.GetAccountByID(ctx, user.Accounts[0].ID)
+	if err != nil || account == nil || account.UserID != user.ID {
+		t.Fatalf("GetAccountByID = %+v, %v; want the default account of %s", account, err, user.ID)
+	}
+	if actions := auditActions(t, db, "users", user.ID); len(actions) != 1 || actions[0] != "create" {
+		t.Fatalf("audit actions for the user = %v, want [create]", actions)
+	}
+
+	again := newTestUser()
+	again.Username = user.Username
+	if err := db.CreateUser(ctx, again); !errors.Is(err, ErrUsernameTaken) {
+		t.Fatalf("CreateUser with a taken username = %v, want ErrUsernameTaken", err)
+	}
+}
+
+func TestPostgresCreateAccount(t *testing.T) {
+	db := testDatabase(t)
+	ctx := context.Background()
+
+	user := newTestUser()
+	if err := db.CreateUser(ctx, user); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	account := user.Accounts[0]
+	account.ID = utils.GenerateID()
+	account.Kind = model.AccountSavings
+	account.Balance = money.Money{Currency: "EUR"}
+	account.Currency = "EUR"
+	account.CreatedAt = account.CreatedAt.Add(time.Second)
+	if err := db.CreateAccount(ctx, &account); err != nil {
+		t.Fatalf("CreateAccount: %v", err)
+	}
+
+	accounts, err := db.ListAccounts(ctx, user.ID, "")
+	if err != nil {
+		t.Fatalf("ListAccounts: %v", err)
+	}
+	if len(accounts) != 2 || accounts[1].ID != account.ID || accounts[1].Kind != model.AccountSavings {
+		t.Fatalf("ListAccounts = %+v, want the default account and %s", accounts, account.ID)
+	}
+	if actions := auditActions(t, db, "accounts", account.ID); len(actions) != 1 || actions[0] != "create" {
+		t.Fatalf("audit actions for the account = %v, want [create]", actions)
+	}
+
+	for _, id := range []string{"not-a-uuid", utils.GenerateID()} {
+		if missing, err := db.GetAccountByID(ctx, id); missing != nil || err != nil {
+			t.Fatalf("GetAccountByID(%q) = %+v, %v; want nil, nil", id, missing, err)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"payment-server/model"
+	"time"
+)
+
+func (db *Database) CreateRefreshToken(ctx context.Context, token *model.RefreshToken) error {
+	return insertRefreshToken(ctx, db.db, token)
+}
+
+func (db *Database) GetRefreshToken(ctx context.Context, tokenHash string) (*model.RefreshToken, error) {
+	token := &model.RefreshToken{}
+	var revokedAt sql.NullTime
+	var replacedBy sql.NullString
+	err := db.db.QueryRowContext(ctx, `
+		SELECT id, user_id, token_hash, family_id, expires_at, revoked_at, replaced_by, created_at
+		FROM refresh_tokens
+		WHERE token_hash = $1`,
+		tokenHash,
+	).Scan(
+		&token.ID,
+		&token.UserID,
+		&token.TokenHash,
+		&token.FamilyID,
+		&token.ExpiresAt,
+		&revokedAt,
+		&replacedBy,
+		&token.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if revokedAt.Valid {
+		token.RevokedAt = &revokedAt.Time
+	}
+	token.ReplacedBy = replacedBy.String
+	return token, nil
+}
+
+func (db *Database) RotateRefreshToken(ctx context.Context, oldID string, next *model.RefreshToken) error {
+	tx, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Only one concurrent refresh may consume the old token
+	result, err := tx.ExecContext(ctx, `
+		UPDATE refresh_tokens
+		SET revoked_at = $1, replaced_by = $2
+		WHERE id = $3 AND revoked_at IS NULL`,
+		next.CreatedAt, next.ID, oldID,
+	)
+	if err != nil {
+		return err
+	}
+	if revoked, err := result.RowsAffected(); err != nil {
+		return err
+	} else if revoked == 0 {
+		return ErrRefreshTokenReused
+	}
+
+	if err := insertRefreshToken(ctx, tx, next); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (db *Database) RevokeRefreshTokenFamily(ctx context.Context, familyID string, at time.Time) error {
+	_, err := db.db.ExecContext(ctx, `
+		UPDATE refresh_tokens SET revoked_at = $1
+		WHERE family_id = $2 AND revoked_at IS NULL`,
+		at, familyID,
+	)
+	return err
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+func insertRefreshToken(ctx context.Context, exec execer, token *model.RefreshToken) error {
+	_, err := exec.ExecContext(ctx, `
+		INSERT INTO refresh_tokens (id, user_id, token_hash, family_id, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		token.ID, token.UserID, token.TokenHash, token.FamilyID, token.ExpiresAt, token.CreatedAt,
+	)
+	return err
+}
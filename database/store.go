@@ -0,0 +1,137 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"payment-server/ledger"
+	"payment-server/model"
+	"time"
+)
+
+var (
+	// ErrRefreshTokenReused means the refresh token was already exchanged or
+	// revoked, so it may have been stolen
+	ErrRefreshTokenReused   = errors.New("refresh token was already used")
+	ErrAPIKeyNotFound       = errors.New("api key not found")
+	ErrUserNotFound         = errors.New("user not found")
+	ErrAccountNotFound      = errors.New("account not found")
+	ErrUsernameTaken        = errors.New("username already exists")
+	ErrCallbackHostNotFound = errors.New("callback host not found")
+)
+
+// Store is the persistence layer used by the controllers. Database is the
+// Postgres implementation and MemoryStore keeps everything in process.
+type Store interface {
+	SaveTransaction(transaction *model.Transaction) error
+	GetTransactionByID(id string) (*model.Transaction, error)
+	// UpdateTransactionStatus moves a transaction from one status to another
+	// if the state machine allows it and the stored status still equals from.
+	// The payment.updated webhook is queued atomically with the change.
+	UpdateTransactionStatus(id, from, to string) (*model.Transaction, error)
+	// CancelTransaction is UpdateTransactionStatus to cancelled that also
+	// records why the transaction was cancelled.
+	CancelTransaction(id, from, reason string) (*model.Transaction, error)
+	// SetProviderReference records the provider's ID for the collection
+	SetProviderReference(id, reference string) error
+	// GetTransactionByProviderReference returns nil when no transaction
+	// collected by the provider has the reference
+	GetTransactionByProviderReference(provider, reference string) (*model.Transaction, error)
+	// ListExpiredTransactions returns up to limit pending or processing
+	// transactions whose ExpiresAt is before the given time, oldest expiry
+	// first.
+	ListExpiredTransactions(ctx context.Context, before time.Time, limit int) ([]model.Transaction, error)
+	// ListTransactionsToReconcile returns up to limit pending or processing
+	// transactions created before createdBefore whose provider status query
+	// is due at now, least recently queried first.
+	ListTransactionsToReconcile(ctx context.Context, createdBefore, now time.Time, limit int) ([]model.Transaction, error)
+	// ScheduleStatusQuery records how many status queries were made for a
+	// transaction and when the next one is due
+	ScheduleStatusQuery(ctx context.Context, id string, queries int, next time.Time) error
+
+	// ClaimDueWebhookEvents leases up to limit pending outbox events that are
+	// due at now; claimed events are not handed out again until lease passes.
+	ClaimDueWebhookEvents(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]model.WebhookEvent, error)
+	// RecordWebhookAttempt logs a delivery attempt and saves the event's new state
+	RecordWebhookAttempt(ctx context.Context, event *model.WebhookEvent, attempt *model.WebhookAttempt) error
+	ListWebhookEvents(ctx context.Context, transactionID string) ([]model.WebhookEvent, error)
+
+	// RotateWebhookSecret makes secret the merchant's newest signing secret;
+	// the previous one keeps signing until previousExpiresAt.
+	RotateWebhookSecret(ctx context.Context, secret *model.WebhookSecret, previousExpiresAt time.Time) error
+	// ListActiveWebhookSecrets returns the merchant's unexpired secrets, newest first
+	ListActiveWebhookSecrets(ctx context.Context, merchantID string, now time.Time) ([]model.WebhookSecret, error)
+	// AddCallbackHost allowlists a host for the merchant's callback URLs;
+	// adding a host twice keeps the first one and fills host with it
+	AddCallbackHost(ctx context.Context, host *model.CallbackHost) error
+	// RemoveCallbackHost returns ErrCallbackHostNotFound when the merchant
+	// did not allowlist host
+	RemoveCallbackHost(ctx context.Context, merchantID, host string) error
+	// ListCallbackHosts returns the merchant's allowlisted hosts by name
+	ListCallbackHosts(ctx context.Context, merchantID string) ([]model.CallbackHost, error)
+	CheckUsernameExists(ctx context.Context, username string) (bool, error)
+	// CreateUser inserts the user and its Accounts in one transaction. It
+	// returns ErrUsernameTaken if the username is already registered.
+	CreateUser(ctx context.Context, user *model.User) error
+	CreateAccount(ctx context.Context, account *model.Account) error
+	GetAccountByID(ctx context.Context, id string) (*model.Account, error)
+	// ListAccounts returns the user's accounts, oldest first, optionally
+	// only those with the given status
+	ListAccounts(ctx context.Context, userID, status string) ([]model.Account, error)
+	// GetClearingAccount returns the clearing account of currency, opening
+	// it on first use
+	GetClearingAccount(ctx context.Context, currency string) (*model.Account, error)
+	// UpdateAccountDetails saves the name, description and metadata of an account
+	UpdateAccountDetails(ctx context.Context, account *model.Account) error
+	GetUserByUsername(ctx context.Context, username string) (*model.User, error)
+	GetUserByID(ctx context.Context, id string) (*model.User, error)
+	UpdateLastLogin(ctx context.Context, userID string, at time.Time) error
+	UpdateUserRole(ctx context.Context, userID, role string) error
+	CreateAuditLog(ctx context.Context, entry *model.AuditLog) error
+
+	CreateRefreshToken(ctx context.Context, token *model.RefreshToken) error
+	GetRefreshToken(ctx context.Context, tokenHash string) (*model.RefreshToken, error)
+	// RotateRefreshToken revokes the token oldID and stores next in its place.
+	// It returns ErrRefreshTokenReused if oldID was already revoked.
+	RotateRefreshToken(ctx context.Context, oldID string, next *model.RefreshToken) error
+	// RevokeRefreshTokenFamily revokes every token descending from the same login
+	RevokeRefreshTokenFamily(ctx context.Context, familyID string, at time.Time) error
+
+	CreateAPIKey(ctx context.Context, key *model.APIKey) error
+	// GetAPIKeyByPrefix returns the key with the given public prefix,
+	// including revoked keys
+	GetAPIKeyByPrefix(ctx context.Context, prefix string) (*model.APIKey, error)
+	ListAPIKeys(ctx context.Context, merchantID string) ([]model.APIKey, error)
+	// RevokeAPIKey returns ErrAPIKeyNotFound unless the merchant owns an
+	// unrevoked key with that ID
+	RevokeAPIKey(ctx context.Context, merchantID, id string, at time.Time) error
+
+	// ReserveIdempotencyKey claims record's key for its client. When a live
+	// record already holds the key it is returned instead and nothing changes.
+	ReserveIdempotencyKey(ctx context.Context, record *model.IdempotencyRecord) (*model.IdempotencyRecord, error)
+	SaveIdempotencyResponse(ctx context.Context, clientID, key string, statusCode int, body []byte) error
+	ReleaseIdempotencyKey(ctx context.Context, clientID, key string) error
+
+	// PostEntry applies a balanced journal entry to the account balances and
+	// records its postings in one transaction
+	PostEntry(ctx context.Context, entry *ledger.Entry) ([]ledger.Posting, error)
+	LedgerTotals(ctx context.Context) (map[string]int64, error)
+	LedgerDrift(ctx context.Context) ([]ledger.Drift, error)
+
+	// CreateTransfer saves transfer and posts the entry that settles it in
+	// one transaction; nothing is saved if the entry is rejected
+	CreateTransfer(ctx context.Context, transfer *model.Transfer, entry *ledger.Entry) ([]ledger.Posting, error)
+	GetTransferByID(ctx context.Context, id string) (*model.Transfer, error)
+
+	ListAccountLimits(ctx context.Context) ([]model.AccountLimits, error)
+	// UpsertAccountLimits replaces the limits of an account type and
+	// currency, keeping the ID of an existing row
+	UpsertAccountLimits(ctx context.Context, limits *model.AccountLimits) error
+
+	Close() error
+}
+
+var (
+	_ ledger.Store = Store(nil)
+	_ Store        = (*Database)(nil)
+	_ Store        = (*MemoryStore)(nil)
+)
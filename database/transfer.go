@@ -0,0 +1,81 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"payment-server/ledger"
+	"payment-server/model"
+)
+
+const transferColumns = `id, from_account_id, to_account_id, amount, currency, status, description, reference_id, executed_at, created_at, updated_at`
+
+func (db *Database) CreateTransfer(ctx context.Context, transfer *model.Transfer, entry *ledger.Entry) ([]ledger.Posting, error) {
+	tx, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// The payment row goes first since postings reference it
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO payments (id, from_account_id, to_account_id, amount, currency, status, description, reference_id, executed_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), NULLIF($8, ''), $9, $10, $11)`,
+		transfer.ID,
+		transfer.FromAccountID,
+		transfer.ToAccountID,
+		transfer.Amount.Amount,
+		transfer.Amount.Currency,
+		transfer.Status,
+		transfer.Description,
+		transfer.Reference,
+		transfer.ExecutedAt,
+		transfer.CreatedAt,
+		transfer.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	postings, err := postEntry(ctx, tx, entry)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return postings, nil
+}
+
+func (db *Database) GetTransferByID(ctx context.Context, id string) (*model.Transfer, error) {
+	if !isUUID(id) {
+		return nil, nil
+	}
+	transfer := &model.Transfer{}
+	var description, reference sql.NullString
+	var executedAt sql.NullTime
+	err := db.db.QueryRowContext(ctx, `SELECT `+transferColumns+` FROM payments WHERE id = $1`, id).Scan(
+		&transfer.ID,
+		&transfer.FromAccountID,
+		&transfer.ToAccountID,
+		&transfer.Amount.Amount,
+		&transfer.Amount.Currency,
+		&transfer.Status,
+		&description,
+		&reference,
+		&executedAt,
+		&transfer.CreatedAt,
+		&transfer.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	transfer.Description = description.String
+	transfer.Reference = reference.String
+	if executedAt.Valid {
+		transfer.ExecutedAt = &executedAt.Time
+	}
+	return transfer, nil
+}
@@ -4,9 +4,16 @@ package database
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"payment-server/model"
+	"time"
+
+	"github.com/lib/pq"
 )
 
+// uniqueViolation is the Postgres error code for a duplicate key
+const uniqueViolation = "23505"
+
 func (db *Database) CheckUsernameExists(ctx context.Context, username string) (bool, error) {
 	var exists bool
 	query := `SELECT EXISTS(SELECT 1 FROM users WHERE username = $1)`
@@ -14,35 +21,96 @@ func (db *Database) CheckUsernameExists(ctx context.Context, username string) (b
 	return exists, err
 }
 
-func (db *Database) CreateUser(ctx context.Context, tx *sql.Tx, user *model.User) error {
+func (db *Database) CreateUser(ctx context.Context, user *model.User) error {
+	tx, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	query := `
-		INSERT INTO users (id, username, password, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5)`
+		INSERT INTO users (id, username, password, role, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`
 
-	_, err := tx.ExecContext(ctx, query,
+	_, err = tx.ExecContext(ctx, query,
 		user.ID,
 		user.Username,
 		user.Password,
+		user.Role,
 		user.CreatedAt,
 		user.UpdatedAt,
 	)
-	return err
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+		return ErrUsernameTaken
+	}
+	if err != nil {
+		return err
+	}
+
+	for i := range user.Accounts {
+		if err := insertAccount(ctx, tx, &user.Accounts[i]); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
 }
 
-func (db *Database) CreateAccount(ctx context.Context, tx *sql.Tx, account *model.Account) error {
-	query := `
-		INSERT INTO accounts (id, user_id, balance, currency, status, kind, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
-
-	_, err := tx.ExecContext(ctx, query,
-		account.ID,
-		account.UserID,
-		account.Balance,
-		account.Currency,
-		account.Status,
-		account.Kind,
-		account.CreatedAt,
-		account.UpdatedAt,
+const userColumns = `id, username, password, role, last_login_at, created_at, updated_at`
+
+func scanUser(row rowScanner) (*model.User, error) {
+	var user model.User
+	var lastLoginAt sql.NullTime
+	err := row.Scan(
+		&user.ID,
+		&user.Username,
+		&user.Password,
+		&user.Role,
+		&lastLoginAt,
+		&user.CreatedAt,
+		&user.UpdatedAt,
 	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if lastLoginAt.Valid {
+		user.LastLoginAt = &lastLoginAt.Time
+	}
+	return &user, nil
+}
+
+func (db *Database) GetUserByUsername(ctx context.Context, username string) (*model.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE username = $1`
+	return scanUser(db.db.QueryRowContext(ctx, query, username))
+}
+
+func (db *Database) GetUserByID(ctx context.Context, id string) (*model.User, error) {
+	if !isUUID(id) {
+		return nil, nil
+	}
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = $1`
+	return scanUser(db.db.QueryRowContext(ctx, query, id))
+}
+
+func (db *Database) UpdateLastLogin(ctx context.Context, userID string, at time.Time) error {
+	_, err := db.db.ExecContext(ctx, `UPDATE users SET last_login_at = $1 WHERE id = $2`, at, userID)
 	return err
 }
+
+func (db *Database) UpdateUserRole(ctx context.Context, userID, role string) error {
+	result, err := db.db.ExecContext(ctx, `UPDATE users SET role = $1 WHERE id = $2`, role, userID)
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
@@ -0,0 +1,345 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"payment-server/model"
+	"payment-server/utils"
+	"time"
+)
+
+const webhookEventColumns = `
+	id, merchant_id, transaction_id, event_type, url, payload, status, attempts,
+	next_attempt_at, last_error, created_at, updated_at, delivered_at`
+
+// enqueueWebhook writes the outbox event for a status change inside tx
+func enqueueWebhook(tx *sql.Tx, transaction *model.Transaction) error {
+	if transaction.WebhookURL == "" {
+		return nil
+	}
+
+	event, err := model.NewPaymentUpdatedEvent(utils.GenerateID(), *transaction)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO webhook_outbox (`+webhookEventColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`,
+		event.ID,
+		event.MerchantID,
+		event.TransactionID,
+		event.EventType,
+		event.URL,
+		[]byte(event.Payload),
+		event.Status,
+		event.Attempts,
+		event.NextAttemptAt,
+		event.LastError,
+		event.CreatedAt,
+		event.UpdatedAt,
+		event.DeliveredAt,
+	)
+	return err
+}
+
+func (db *Database) ClaimDueWebhookEvents(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]model.WebhookEvent, error) {
+	// Pushing next_attempt_at forward leases the rows to this worker; if it
+	// dies mid-delivery the events become due again once the lease ends.
+	// SKIP LOCKED lets several server instances claim disjoint batches.
+	query := `
+		UPDATE webhook_outbox
+		SET next_attempt_at = $1
+		WHERE id IN (
+			SELECT id FROM webhook_outbox
+			WHERE status = $2 AND next_attempt_at <= $3
+			ORDER BY next_attempt_at
+			LIMIT $4
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + webhookEventColumns
+	rows, err := db.db.QueryContext(ctx, query, now.Add(lease), model.WebhookPending, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []model.WebhookEvent
+	for rows.Next() {
+		event, err := scanWebhookEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, *event)
+	}
+	return events, rows.Err()
+}
+
+func (db *Database) RecordWebhookAttempt(ctx context.Context, event *model.WebhookEvent, attempt *model.WebhookAttempt) error {
+	tx, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO webhook_delivery_attempts (event_id, attempt, status_code, latency_ms, response_snippet, error, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		attempt.EventID,
+		attempt.Attempt,
+		attempt.StatusCode,
+		attempt.LatencyMS,
+		attempt.ResponseSnippet,
+		attempt.Error,
+		attempt.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE webhook_outbox
+		SET status = $1, attempts = $2, next_attempt_at = $3, last_error = $4,
+			delivered_at = $5, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $6`,
+		event.Status,
+		event.Attempts,
+		event.NextAttemptAt,
+		event.LastError,
+		event.DeliveredAt,
+		event.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (db *Database) ListWebhookEvents(ctx context.Context, transactionID string) ([]model.WebhookEvent, error) {
+	rows, err := db.db.QueryContext(ctx, `
+		SELECT `+webhookEventColumns+`
+		FROM webhook_outbox
+		WHERE transaction_id = $1
+		ORDER BY created_at`,
+		transactionID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []model.WebhookEvent
+	for rows.Next() {
+		event, err := scanWebhookEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, *event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range events {
+		events[i].Deliveries, err = db.listWebhookAttempts(ctx, events[i].ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return events, nil
+}
+
+func (db *Database) listWebhookAttempts(ctx context.Context, eventID string) ([]model.WebhookAttempt, error) {
+	rows, err := db.db.QueryContext(ctx, `
+		SELECT event_id, attempt, status_code, latency_ms, response_snippet, error, created_at
+		FROM webhook_delivery_attempts
+		WHERE event_id = $1
+		ORDER BY attempt`,
+		eventID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attempts []model.WebhookAttempt
+	for rows.Next() {
+		var attempt model.WebhookAttempt
+		err := rows.Scan(
+			&attempt.EventID,
+			&attempt.Attempt,
+			&attempt.StatusCode,
+			&attempt.LatencyMS,
+			&attempt.ResponseSnippet,
+			&attempt.Error,
+			&attempt.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, attempt)
+	}
+	return attempts, rows.Err()
+}
+
+func scanWebhookEvent(row rowScanner) (*model.WebhookEvent, error) {
+	event := &model.WebhookEvent{}
+	var payload []byte
+	var deliveredAt sql.NullTime
+	err := row.Scan(
+		&event.ID,
+		&event.MerchantID,
+		&event.TransactionID,
+		&event.EventType,
+		&event.URL,
+		&payload,
+		&event.Status,
+		&event.Attempts,
+		&event.NextAttemptAt,
+		&event.LastError,
+		&event.CreatedAt,
+		&event.UpdatedAt,
+		&deliveredAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	event.Payload = payload
+	if deliveredAt.Valid {
+		event.DeliveredAt = &deliveredAt.Time
+	}
+	return event, nil
+}
+
+// RotateWebhookSecret stores secret as the merchant's newest signing secret.
+// The previous newest secret stays valid until previousExpiresAt and any
+// older one expires immediately, so at most two secrets are ever active.
+func (db *Database) RotateWebhookSecret(ctx context.Context, secret *model.WebhookSecret, previousExpiresAt time.Time) error {
+	tx, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Serialize concurrent rotations of the same merchant
+	_, err = tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, secret.MerchantID)
+	if err != nil {
+		return err
+	}
+
+	active, err := queryWebhookSecrets(ctx, tx, secret.MerchantID, secret.CreatedAt)
+	if err != nil {
+		return err
+	}
+	for i, previous := range active {
+		expiresAt := secret.CreatedAt
+		if i == 0 && (previous.ExpiresAt == nil || previous.ExpiresAt.After(previousExpiresAt)) {
+			expiresAt = previousExpiresAt
+		}
+		_, err = tx.ExecContext(ctx, `UPDATE webhook_secrets SET expires_at = $1 WHERE id = $2`, expiresAt, previous.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO webhook_secrets (id, merchant_id, secret, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5)`,
+		secret.ID, secret.MerchantID, secret.Secret, secret.CreatedAt, secret.ExpiresAt,
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (db *Database) ListActiveWebhookSecrets(ctx context.Context, merchantID string, now time.Time) ([]model.WebhookSecret, error) {
+	return queryWebhookSecrets(ctx, db.db, merchantID, now)
+}
+
+// queryer is satisfied by both *sql.DB and *sql.Tx
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func queryWebhookSecrets(ctx context.Context, q queryer, merchantID string, now time.Time) ([]model.WebhookSecret, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT id, merchant_id, secret, created_at, expires_at
+		FROM webhook_secrets
+		WHERE merchant_id = $1 AND (expires_at IS NULL OR expires_at > $2)
+		ORDER BY created_at DESC`,
+		merchantID, now,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var secrets []model.WebhookSecret
+	for rows.Next() {
+		var secret model.WebhookSecret
+		var expiresAt sql.NullTime
+		if err := rows.Scan(&secret.ID, &secret.MerchantID, &secret.Secret, &secret.CreatedAt, &expiresAt); err != nil {
+			return nil, err
+		}
+		if expiresAt.Valid {
+			secret.ExpiresAt = &expiresAt.Time
+		}
+		secrets = append(secrets, secret)
+	}
+	return secrets, rows.Err()
+}
+
+func (db *Database) AddCallbackHost(ctx context.Context, host *model.CallbackHost) error {
+	// The no-op update makes RETURNING yield the stored row on a conflict
+	return db.db.QueryRowContext(ctx, `
+		INSERT INTO merchant_callback_hosts (merchant_id, host, created_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (merchant_id, host) DO UPDATE SET host = EXCLUDED.host
+		RETURNING created_at`,
+		host.MerchantID, host.Host, host.CreatedAt,
+	).Scan(&host.CreatedAt)
+}
+
+func (db *Database) RemoveCallbackHost(ctx context.Context, merchantID, host string) error {
+	result, err := db.db.ExecContext(ctx, `
+		DELETE FROM merchant_callback_hosts WHERE merchant_id = $1 AND host = $2`,
+		merchantID, host,
+	)
+	if err != nil {
+		return err
+	}
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if removed == 0 {
+		return ErrCallbackHostNotFound
+	}
+	return nil
+}
+
+func (db *Database) ListCallbackHosts(ctx context.Context, merchantID string) ([]model.CallbackHost, error) {
+	rows, err := db.db.QueryContext(ctx, `
+		SELECT merchant_id, host, created_at
+		FROM merchant_callback_hosts
+		WHERE merchant_id = $1
+		ORDER BY host`,
+		merchantID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hosts []model.CallbackHost
+	for rows.Next() {
+		var host model.CallbackHost
+		if err := rows.Scan(&host.MerchantID, &host.Host, &host.CreatedAt); err != nil {
+			return nil, err
+		}
+		hosts = append(hosts, host)
+	}
+	return hosts, rows.Err()
+}
@@ -1,6 +1,10 @@
 -- migrations/000001_init_schema.up.sql
 CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
 
+-- Supported currencies, printed by `realpay currency-enum` from the currency
+-- package; the server refuses to start if they differ
+CREATE TYPE supported_currency AS ENUM ('USD', 'EUR', 'GBP', 'JPY', 'CNY', 'SGD', 'XOF', 'CHF', 'HKD', 'NZD');
+
 -- Users table
 CREATE TABLE users (
     id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
@@ -15,14 +19,13 @@ CREATE TABLE accounts (
     id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
     user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
     balance BIGINT NOT NULL DEFAULT 0,
-    currency VARCHAR(3) NOT NULL,
+    currency supported_currency NOT NULL,
     status VARCHAR(20) NOT NULL DEFAULT 'active',
     kind VARCHAR(20) NOT NULL DEFAULT 'personal',
     created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
     CONSTRAINT valid_status CHECK (status IN ('active', 'suspended', 'closed')),
-    CONSTRAINT valid_kind CHECK (kind IN ('personal', 'business', 'savings')),
-    CONSTRAINT valid_currency CHECK (currency IN ('USD', 'EUR', 'GBP'))
+    CONSTRAINT valid_kind CHECK (kind IN ('personal', 'business', 'savings'))
 );
 
 -- Payments table
@@ -31,14 +34,13 @@ CREATE TABLE payments (
     from_account_id UUID NOT NULL REFERENCES accounts(id),
     to_account_id UUID NOT NULL REFERENCES accounts(id),
     amount BIGINT NOT NULL,
-    currency VARCHAR(3) NOT NULL,
+    currency supported_currency NOT NULL,
     status VARCHAR(20) NOT NULL DEFAULT 'pending',
     description TEXT,
     metadata JSONB,
     created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
     CONSTRAINT valid_payment_status CHECK (status IN ('pending', 'processing', 'completed', 'failed', 'rejected')),
-    CONSTRAINT valid_payment_currency CHECK (currency IN ('USD', 'EUR', 'GBP')),
     CONSTRAINT positive_amount CHECK (amount > 0)
 );
 
@@ -50,11 +52,10 @@ CREATE TABLE transactions (
     type VARCHAR(20) NOT NULL,
     amount BIGINT NOT NULL,
     balance_after BIGINT NOT NULL,
-    currency VARCHAR(3) NOT NULL,
+    currency supported_currency NOT NULL,
     description TEXT,
     created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
-    CONSTRAINT valid_transaction_type CHECK (type IN ('credit', 'debit')),
-    CONSTRAINT valid_transaction_currency CHECK (currency IN ('USD', 'EUR', 'GBP'))
+    CONSTRAINT valid_transaction_type CHECK (type IN ('credit', 'debit'))
 );
 
 -- Indexes
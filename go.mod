@@ -16,6 +16,12 @@ require github.com/rs/cors v1.10.1
 
 require golang.org/x/crypto v0.29.0
 
+require gopkg.in/yaml.v3 v3.0.1
+
+require github.com/golang-jwt/jwt/v5 v5.2.1
+
+require github.com/prometheus/client_golang v1.20.5
+
 require (
 	github.com/hashicorp/errwrap v1.1.0 // indirect
 	github.com/hashicorp/go-multierror v1.1.1 // indirect
@@ -27,6 +33,15 @@ require (
 )
 
 require (
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	github.com/klauspost/compress v1.17.9 // indirect
+	github.com/kr/text v0.2.0 // indirect
+	github.com/munnerz/goautoneg v0.0.0-20191010083416-a7dc8b61c822 // indirect
+	github.com/prometheus/client_model v0.6.1 // indirect
+	github.com/prometheus/common v0.55.0 // indirect
+	github.com/prometheus/procfs v0.15.1 // indirect
 	github.com/stretchr/testify v1.9.0 // indirect
 	golang.org/x/tools v0.27.0 // indirect
+	google.golang.org/protobuf v1.34.2 // indirect
 )
@@ -0,0 +1,239 @@
+// Package ledger posts double-entry journal entries against account
+// balances. Every entry is a set of lines in one currency whose amounts sum
+// to zero, so money only ever moves between accounts.
+package ledger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"payment-server/money"
+	"payment-server/utils"
+	"sort"
+	"time"
+)
+
+// Line types, mirroring the transaction_type enum
+const (
+	Credit   = "credit"
+	Debit    = "debit"
+	Fee      = "fee"
+	Refund   = "refund"
+	Reversal = "reversal"
+)
+
+var (
+	ErrUnbalanced        = errors.New("ledger: entry does not balance")
+	ErrUnknownAccount    = errors.New("ledger: account not found")
+	ErrCurrencyMismatch  = errors.New("ledger: account currency does not match the entry")
+	ErrAccountNotActive  = errors.New("ledger: account is not active")
+	ErrInsufficientFunds = errors.New("ledger: insufficient funds")
+	ErrOverflow          = errors.New("ledger: amount out of range")
+	// ErrLimitExceeded matches every *LimitError
+	ErrLimitExceeded = errors.New("ledger: account limit exceeded")
+)
+
+// Codes of the account limits an entry can break
+const (
+	SingleTransferLimitExceeded  = "single_transfer_limit_exceeded"
+	DailyTransferLimitExceeded   = "daily_transfer_limit_exceeded"
+	MonthlyTransferLimitExceeded = "monthly_transfer_limit_exceeded"
+	MinBalanceBreached           = "min_balance_breached"
+	MaxBalanceExceeded           = "max_balance_exceeded"
+)
+
+// LimitError rejects an entry that would take an account past one of the
+// account_limits of its type and currency. Attempted is the transfer
+// amount, running total or balance the entry would have produced.
+type LimitError struct {
+	AccountID string
+	Code      string
+	Limit     int64
+	Attempted int64
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("ledger: account %s: %s (limit %d, attempted %d)", e.AccountID, e.Code, e.Limit, e.Attempted)
+}
+
+func (e *LimitError) Is(target error) bool {
+	return target == ErrLimitExceeded
+}
+
+// Line moves Amount into (positive) or out of (negative) an account.
+// Credit lines must be positive and debit lines negative.
+type Line struct {
+	AccountID   string `json:"account_id"`
+	Type        string `json:"type"`
+	Amount      int64  `json:"amount"`
+	Description string `json:"description,omitempty"`
+}
+
+// Entry is one balanced journal entry
+type Entry struct {
+	ID          string    `json:"id"`
+	PaymentID   string    `json:"payment_id,omitempty"`
+	Currency    string    `json:"currency"`
+	Description string    `json:"description,omitempty"`
+	Lines       []Line    `json:"lines"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Posting is a stored line of an entry, a row of the transactions table
+type Posting struct {
+	ID           string    `json:"id"`
+	JournalID    string    `json:"journal_id"`
+	AccountID    string    `json:"account_id"`
+	PaymentID    string    `json:"payment_id,omitempty"`
+	Type         string    `json:"type"`
+	Amount       int64     `json:"amount"`
+	BalanceAfter int64     `json:"balance_after"`
+	Currency     string    `json:"currency"`
+	Description  string    `json:"description,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Drift is an account whose balance differs from the sum of its postings
+type Drift struct {
+	AccountID string `json:"account_id"`
+	Balance   int64  `json:"balance"`
+	Posted    int64  `json:"posted"`
+}
+
+// Store persists entries. PostEntry must lock the accounts of the entry,
+// check them, update their balances and insert the postings atomically,
+// failing with the errors of this package.
+type Store interface {
+	PostEntry(ctx context.Context, entry *Entry) ([]Posting, error)
+	// LedgerTotals sums all postings per currency
+	LedgerTotals(ctx context.Context) (map[string]int64, error)
+	// LedgerDrift lists accounts whose balance is not the sum of their postings
+	LedgerDrift(ctx context.Context) ([]Drift, error)
+}
+
+type Ledger struct {
+	store Store
+}
+
+func New(store Store) *Ledger {
+	return &Ledger{store: store}
+}
+
+// Post validates entry and applies it
+func (l *Ledger) Post(ctx context.Context, entry *Entry) ([]Posting, error) {
+	if err := Prepare(entry); err != nil {
+		return nil, err
+	}
+	return l.store.PostEntry(ctx, entry)
+}
+
+// Transfer posts a debit of from and a matching credit of to
+func (l *Ledger) Transfer(ctx context.Context, paymentID, fromAccountID, toAccountID string, amount int64, currency, description string) ([]Posting, error) {
+	return l.Post(ctx, TransferEntry(paymentID, fromAccountID, toAccountID, amount, currency, description))
+}
+
+// TransferEntry builds the entry moving amount from one account to another
+func TransferEntry(paymentID, fromAccountID, toAccountID string, amount int64, currency, description string) *Entry {
+	return &Entry{
+		PaymentID:   paymentID,
+		Currency:    currency,
+		Description: description,
+		Lines: []Line{
+			{AccountID: fromAccountID, Type: Debit, Amount: -amount, Description: description},
+			{AccountID: toAccountID, Type: Credit, Amount: amount, Description: description},
+		},
+	}
+}
+
+// Prepare validates entry and fills in its ID and CreatedAt when empty.
+// Stores that post an entry as part of a larger write call it first.
+func Prepare(entry *Entry) error {
+	if err := Validate(entry); err != nil {
+		return err
+	}
+	if entry.ID == "" {
+		entry.ID = utils.GenerateID()
+	}
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+	return nil
+}
+
+// Validate checks that entry is well formed and balanced
+func Validate(entry *Entry) error {
+	if entry.Currency == "" {
+		return errors.New("ledger: entry has no currency")
+	}
+	if len(entry.Lines) < 2 {
+		return fmt.Errorf("%w: an entry needs at least two lines", ErrUnbalanced)
+	}
+
+	sum := money.Money{Currency: entry.Currency}
+	for _, line := range entry.Lines {
+		if line.AccountID == "" {
+			return errors.New("ledger: line has no account")
+		}
+		switch {
+		case line.Amount == 0:
+			return errors.New("ledger: line amount must not be zero")
+		case line.Type == Credit && line.Amount < 0:
+			return errors.New("ledger: credit lines must be positive")
+		case line.Type == Debit && line.Amount > 0:
+			return errors.New("ledger: debit lines must be negative")
+		case line.Type != Credit && line.Type != Debit && line.Type != Fee && line.Type != Refund && line.Type != Reversal:
+			return fmt.Errorf("ledger: unknown line type %q", line.Type)
+		}
+		var err error
+		if sum, err = sum.Add(money.Money{Amount: line.Amount, Currency: entry.Currency}); err != nil {
+			return fmt.Errorf("%w: lines do not fit in a sum", ErrOverflow)
+		}
+	}
+	if !sum.IsZero() {
+		return fmt.Errorf("%w: lines sum to %d", ErrUnbalanced, sum.Amount)
+	}
+	return nil
+}
+
+// Violation is a broken ledger invariant
+type Violation struct {
+	Currency  string `json:"currency,omitempty"`
+	AccountID string `json:"account_id,omitempty"`
+	Message   string `json:"message"`
+}
+
+// Verify checks that postings sum to zero in every currency and that every
+// account balance equals the sum of its postings
+func (l *Ledger) Verify(ctx context.Context) ([]Violation, error) {
+	violations := []Violation{}
+
+	totals, err := l.store.LedgerTotals(ctx)
+	if err != nil {
+		return nil, err
+	}
+	currencies := make([]string, 0, len(totals))
+	for currency := range totals {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+	for _, currency := range currencies {
+		if total := totals[currency]; total != 0 {
+			violations = append(violations, Violation{
+				Currency: currency,
+				Message:  fmt.Sprintf("postings sum to %d instead of 0", total),
+			})
+		}
+	}
+
+	drifts, err := l.store.LedgerDrift(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, drift := range drifts {
+		violations = append(violations, Violation{
+			AccountID: drift.AccountID,
+			Message:   fmt.Sprintf("balance %d differs from posted total %d", drift.Balance, drift.Posted),
+		})
+	}
+	return violations, nil
+}
@@ -0,0 +1,233 @@
+package ledger_test
+
+import (
+	"context"
+	"errors"
+	"math"
+	"payment-server/database"
+	"payment-server/ledger"
+	"payment-server/model"
+	"payment-server/money"
+	"payment-server/utils"
+	"testing"
+	"time"
+)
+
+// testLedger is a ledger over a MemoryStore holding one user with two
+// personal USD accounts, a and b, and the USD clearing account that funds
+// them
+type testLedger struct {
+	*ledger.Ledger
+	store    *database.MemoryStore
+	a, b     string
+	clearing string
+}
+
+func newTestLedger(t *testing.T) *testLedger {
+	t.Helper()
+	ctx := context.Background()
+	store := database.NewMemoryStore()
+
+	now := time.Now()
+	user := &model.User{ID: utils.GenerateID(), Username: "ledger", Role: model.RoleCustomer, CreatedAt: now, UpdatedAt: now}
+	for i := 0; i < 2; i++ {
+		user.Accounts = append(user.Accounts, model.Account{
+			ID:        utils.GenerateID(),
+			UserID:    user.ID,
+			Balance:   money.Money{Currency: "USD"},
+			Currency:  "USD",
+			Status:    model.AccountActive,
+			Kind:      model.AccountPersonal,
+			CreatedAt: now,
+			UpdatedAt: now,
+		})
+	}
+	if err := store.CreateUser(ctx, user); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	clearing, err := store.GetClearingAccount(ctx, "USD")
+	if err != nil {
+		t.Fatalf("GetClearingAccount: %v", err)
+	}
+
+	return &testLedger{
+		Ledger:   ledger.New(store),
+		store:    store,
+		a:        user.Accounts[0].ID,
+		b:        user.Accounts[1].ID,
+		clearing: clearing.ID,
+	}
+}
+
+func (l *testLedger) deposit(t *testing.T, accountID string, amount int64) {
+	t.Helper()
+	if _, err := l.Transfer(context.Background(), "", l.clearing, accountID, amount, "USD", "deposit"); err != nil {
+		t.Fatalf("deposit of %d: %v", amount, err)
+	}
+}
+
+func (l *testLedger) balance(t *testing.T, accountID string) int64 {
+	t.Helper()
+	account, err := l.store.GetAccountByID(context.Background(), accountID)
+	if err != nil || account == nil {
+		t.Fatalf("GetAccountByID(%s) = %+v, %v", accountID, account, err)
+	}
+	return account.Balance.Amount
+}
+
+// requireConsistent fails the test unless Verify finds the ledger balanced
+func (l *testLedger) requireConsistent(t *testing.T) {
+	t.Helper()
+	violations, err := l.Verify(context.Background())
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if len(violations) > 0 {
+		t.Fatalf("Verify found violations: %+v", violations)
+	}
+}
+
+func TestTransfer(t *testing.T) {
+	l := newTestLedger(t)
+	l.deposit(t, l.a, 1000)
+
+	postings, err := l.Transfer(context.Background(), "", l.a, l.b, 400, "USD", "rent")
+	if err != nil {
+		t.Fatalf("Transfer: %v", err)
+	}
+	if len(postings) != 2 || postings[0].BalanceAfter != 600 || postings[1].BalanceAfter != 400 {
+		t.Fatalf("Transfer postings = %+v", postings)
+	}
+	if a, b := l.balance(t, l.a), l.balance(t, l.b); a != 600 || b != 400 {
+		t.Fatalf("balances after the transfer = %d, %d; want 600, 400", a, b)
+	}
+	l.requireConsistent(t)
+}
+
+func TestPostRejectsUnbalancedEntries(t *testing.T) {
+	l := newTestLedger(t)
+	l.deposit(t, l.a, 1000)
+
+	entries := map[string][]ledger.Line{
+		"lines sum to -100": {
+			{AccountID: l.a, Type: ledger.Debit, Amount: -500},
+			{AccountID: l.b, Type: ledger.Credit, Amount: 400},
+		},
+		"single line": {
+			{AccountID: l.b, Type: ledger.Credit, Amount: 400},
+		},
+	}
+	for name, lines := range entries {
+		entry := &ledger.Entry{Currency: "USD", Lines: lines}
+		if _, err := l.Post(context.Background(), entry); !errors.Is(err, ledger.ErrUnbalanced) {
+			t.Errorf("%s: Post = %v, want ErrUnbalanced", name, err)
+		}
+	}
+
+	if a, b := l.balance(t, l.a), l.balance(t, l.b); a != 1000 || b != 0 {
+		t.Fatalf("balances after rejected entries = %d, %d; want 1000, 0", a, b)
+	}
+	l.requireConsistent(t)
+}
+
+func TestPostRejectsOverflow(t *testing.T) {
+	l := newTestLedger(t)
+	ctx := context.Background()
+
+	// Balanced in arbitrary precision, but the running sum leaves int64
+	entry := &ledger.Entry{Currency: "USD", Lines: []ledger.Line{
+		{AccountID: l.a, Type: ledger.Credit, Amount: math.MaxInt64},
+		{AccountID: l.b, Type: ledger.Credit, Amount: 1},
+		{AccountID: l.clearing, Type: ledger.Debit, Amount: -math.MaxInt64},
+		{AccountID: l.clearing, Type: ledger.Debit, Amount: -1},
+	}}
+	if _, err := l.Post(ctx, entry); !errors.Is(err, ledger.ErrOverflow) {
+		t.Fatalf("Post of lines overflowing their sum = %v, want ErrOverflow", err)
+	}
+
+	// The clearing account can go down to -MaxInt64, so a credits a
+	// balance that cannot grow any further
+	l.deposit(t, l.a, math.MaxInt64)
+	if _, err := l.Transfer(ctx, "", l.clearing, l.a, 1, "USD", "deposit"); !errors.Is(err, ledger.ErrOverflow) {
+		t.Fatalf("deposit past MaxInt64 = %v, want ErrOverflow", err)
+	}
+	if _, err := l.Transfer(ctx, "", l.clearing, l.b, 2, "USD", "deposit"); !errors.Is(err, ledger.ErrOverflow) {
+		t.Fatalf("withdrawal from clearing past MinInt64 = %v, want ErrOverflow", err)
+	}
+
+	if a := l.balance(t, l.a); a != math.MaxInt64 {
+		t.Fatalf("balance of a = %d, want MaxInt64", a)
+	}
+	if b := l.balance(t, l.b); b != 0 {
+		t.Fatalf("balance of b = %d, want 0", b)
+	}
+	l.requireConsistent(t)
+}
+
+func TestPostRejectsInsufficientFunds(t *testing.T) {
+	l := newTestLedger(t)
+	l.deposit(t, l.a, 100)
+
+	if _, err := l.Transfer(context.Background(), "", l.a, l.b, 101, "USD", "overdraw"); !errors.Is(err, ledger.ErrInsufficientFunds) {
+		t.Fatalf("Transfer beyond the balance = %v, want ErrInsufficientFunds", err)
+	}
+	if a := l.balance(t, l.a); a != 100 {
+		t.Fatalf("balance of a = %d, want 100", a)
+	}
+	l.requireConsistent(t)
+}
+
+func TestPostEnforcesLimits(t *testing.T) {
+	l := newTestLedger(t)
+	ctx := context.Background()
+
+	maxBalance := money.Money{Amount: 10000, Currency: "USD"}
+	err := l.store.UpsertAccountLimits(ctx, &model.AccountLimits{
+		ID:                   utils.GenerateID(),
+		AccountType:          model.AccountPersonal,
+		Currency:             "USD",
+		SingleTransferLimit:  money.Money{Amount: 1000, Currency: "USD"},
+		DailyTransferLimit:   money.Money{Amount: 1500, Currency: "USD"},
+		MonthlyTransferLimit: money.Money{Amount: 50000, Currency: "USD"},
+		MinBalance:           money.Money{Amount: 100, Currency: "USD"},
+		MaxBalance:           &maxBalance,
+	})
+	if err != nil {
+		t.Fatalf("UpsertAccountLimits: %v", err)
+	}
+	l.deposit(t, l.a, 5000)
+
+	transfer := func(from, to string, amount int64) error {
+		_, err := l.Transfer(ctx, "", from, to, amount, "USD", "limits")
+		return err
+	}
+	requireLimit := func(err error, code string, attempted int64) {
+		t.Helper()
+		var limitErr *ledger.LimitError
+		if !errors.As(err, &limitErr) || !errors.Is(err, ledger.ErrLimitExceeded) {
+			t.Fatalf("got %v, want a LimitError %s", err, code)
+		}
+		if limitErr.Code != code || limitErr.Attempted != attempted {
+			t.Fatalf("got %s attempting %d, want %s attempting %d", limitErr.Code, limitErr.Attempted, code, attempted)
+		}
+	}
+
+	requireLimit(transfer(l.a, l.b, 1001), ledger.SingleTransferLimitExceeded, 1001)
+	if err := transfer(l.a, l.b, 1000); err != nil {
+		t.Fatalf("Transfer at the single limit: %v", err)
+	}
+	// Rejected entries do not count towards the daily total
+	requireLimit(transfer(l.a, l.b, 501), ledger.DailyTransferLimitExceeded, 1501)
+	if err := transfer(l.a, l.b, 500); err != nil {
+		t.Fatalf("Transfer up to the daily limit: %v", err)
+	}
+
+	// b holds 1500 and has not transferred anything today
+	requireLimit(transfer(l.b, l.a, 1401), ledger.MinBalanceBreached, 99)
+	requireLimit(transfer(l.clearing, l.b, 8501), ledger.MaxBalanceExceeded, 10001)
+
+	if a, b := l.balance(t, l.a), l.balance(t, l.b); a != 3500 || b != 1500 {
+		t.Fatalf("balances = %d, %d; want 3500, 1500", a, b)
+	}
+	l.requireConsistent(t)
+}
@@ -5,58 +5,83 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/cors"
 	"github.com/rs/zerolog"
 	"net/http"
 	"os"
 	"os/signal"
+	"payment-server/auth"
+	"payment-server/config"
 	"payment-server/controllers"
+	"payment-server/currency"
 	"payment-server/database"
+	"payment-server/ledger"
 	"payment-server/middleware"
+	"payment-server/model"
+	"payment-server/provider"
+	"payment-server/utils"
+	"payment-server/webhook"
+	"payment-server/worker"
 	"syscall"
 	"time"
 )
 
-const (
-	defaultPort     = "8082"
-	shutdownTimeout = 15 * time.Second
-	readTimeout     = 10 * time.Second
-	writeTimeout    = 30 * time.Second
-	idleTimeout     = 120 * time.Second
-)
-
 func main() {
+	// Print the supported_currency enum for writing migrations
+	if len(os.Args) > 1 && os.Args[1] == "currency-enum" {
+		fmt.Print(currency.EnumSQL())
+		return
+	}
+
 	// Initialize logger
 	log := initLogger()
 
-	// Get port from environment variable or use default
-	port := getEnvOrDefault("PORT", defaultPort)
+	// Load and validate configuration
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load configuration")
+	}
 
-	// Initialize database
-	db := database.NewDatabase() // Removed err from assignment since NewDatabase returns 1 value
+	// Initialize storage
+	db := initStore(cfg, log)
+	defer db.Close()
+	initAdmins(cfg, db, log)
 
 	// Initialize router and controllers
-	router := initRouter(db)
+	providers := initProviders(cfg, log)
+	sender := webhook.NewSender(cfg.Webhooks.Timeout.Duration, db)
+	router := initRouter(cfg, db, initTokenManager(cfg, log), providers, sender)
+
+	// Start background workers
+	workers := []worker.Worker{
+		worker.NewExpirySweeper(db, cfg.Payments.ExpirySweepInterval.Duration),
+		worker.NewWebhookDispatcher(db, sender, cfg.Webhooks),
+		worker.NewReconciler(db, providers, cfg.Providers),
+	}
+	for _, w := range workers {
+		w.Start()
+	}
 
 	// Configure server
 	server := &http.Server{
-		Addr:         fmt.Sprintf(":%s", port),
+		Addr:         fmt.Sprintf(":%s", cfg.Server.Port),
 		Handler:      router,
-		ReadTimeout:  readTimeout,
-		WriteTimeout: writeTimeout,
-		IdleTimeout:  idleTimeout,
+		ReadTimeout:  cfg.Server.ReadTimeout.Duration,
+		WriteTimeout: cfg.Server.WriteTimeout.Duration,
+		IdleTimeout:  cfg.Server.IdleTimeout.Duration,
 	}
 
 	// Start server in a goroutine
 	go func() {
-		log.Info().Str("port", port).Msg("Starting server")
+		log.Info().Str("port", cfg.Server.Port).Msg("Starting server")
 		if err := server.ListenAndServe(); err != http.ErrServerClosed {
 			log.Fatal().Err(err).Msg("Server failed to start")
 		}
 	}()
 
 	// Wait for interrupt signal to gracefully shut down the server
-	gracefulShutdown(server, log)
+	gracefulShutdown(server, workers, cfg.Server.ShutdownTimeout.Duration, log)
 }
 
 func initLogger() zerolog.Logger {
@@ -73,12 +98,114 @@ func initLogger() zerolog.Logger {
 	return log
 }
 
-func initRouter(db *database.Database) http.Handler {
+// initStore selects the storage backend configured in database.driver
+func initStore(cfg *config.Config, log zerolog.Logger) database.Store {
+	if cfg.Database.Driver == "memory" {
+		log.Warn().Msg("Using in-memory store, data will be lost on restart")
+		return database.NewMemoryStore()
+	}
+	return database.NewDatabase(cfg.Database)
+}
+
+// initAdmins promotes the users listed in ADMIN_USER_IDS. Users are named by
+// ID rather than username because anyone can register a username.
+func initAdmins(cfg *config.Config, db database.Store, log zerolog.Logger) {
+	ctx := context.Background()
+	for _, userID := range cfg.Auth.AdminUserIDs {
+		user, err := db.GetUserByID(ctx, userID)
+		if err != nil {
+			log.Fatal().Err(err).Str("userID", userID).Msg("Failed to load configured admin")
+		}
+		if user == nil {
+			log.Warn().Str("userID", userID).Msg("Configured admin does not exist")
+			continue
+		}
+		if user.Role == model.RoleAdmin {
+			continue
+		}
+
+		if err := db.UpdateUserRole(ctx, userID, model.RoleAdmin); err != nil {
+			log.Fatal().Err(err).Str("userID", userID).Msg("Failed to promote configured admin")
+		}
+		changes, _ := json.Marshal(map[string]string{"old": user.Role, "new": model.RoleAdmin})
+		entry := &model.AuditLog{
+			ID:         utils.GenerateID(),
+			EntityType: "users",
+			EntityID:   userID,
+			Action:     model.AuditRoleChange,
+			ActorID:    model.SystemUserID,
+			ActorType:  "system",
+			Changes:    changes,
+			CreatedAt:  time.Now(),
+		}
+		if err := db.CreateAuditLog(ctx, entry); err != nil {
+			log.Error().Err(err).Str("userID", userID).Msg("Failed to record role change")
+		}
+		log.Info().Str("userID", userID).Msg("Promoted configured admin")
+	}
+}
+
+// initTokenManager signs access tokens with a throwaway secret when none is
+// configured, so tokens do not survive a restart
+func initTokenManager(cfg *config.Config, log zerolog.Logger) *auth.TokenManager {
+	secret := cfg.Auth.JWTSecret
+	if secret == "" {
+		var err error
+		if secret, err = auth.NewSecret(); err != nil {
+			log.Fatal().Err(err).Msg("Failed to generate JWT secret")
+		}
+		log.Warn().Msg("JWT_SECRET is not set, access tokens are signed with a temporary secret")
+	}
+	return auth.NewTokenManager(cfg.Auth, secret)
+}
+
+// initProviders registers the mobile money provider adapters and routes
+// payer phone prefixes to them
+func initProviders(cfg *config.Config, log zerolog.Logger) *provider.Registry {
+	registry := provider.NewRegistry()
+	registry.Register(provider.NewSimulator(callbackSecret(cfg, provider.SimulatorCode, log)))
+
+	for prefix, code := range cfg.Providers.Routes {
+		if err := registry.Route(prefix, code); err != nil {
+			log.Fatal().Err(err).Str("prefix", prefix).Msg("Invalid provider route")
+		}
+	}
+	if cfg.Providers.Default != "" {
+		if err := registry.SetDefault(cfg.Providers.Default); err != nil {
+			log.Fatal().Err(err).Msg("Invalid default provider")
+		}
+	}
+	return registry
+}
+
+// callbackSecret returns the secret that verifies callbacks of the provider,
+// generating a throwaway one when none is configured
+func callbackSecret(cfg *config.Config, code string, log zerolog.Logger) string {
+	if secret := cfg.Providers.CallbackSecrets[code]; secret != "" {
+		return secret
+	}
+	secret, err := webhook.NewSecret()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to generate provider callback secret")
+	}
+	log.Warn().Str("provider", code).Msg("No callback secret is configured, provider callbacks are verified with a temporary secret")
+	return secret
+}
+
+func initRouter(cfg *config.Config, db database.Store, tokens *auth.TokenManager, providers *provider.Registry, sender *webhook.Sender) http.Handler {
 	router := mux.NewRouter()
 
 	// Initialize controllers
-	paymentController := controllers.NewPaymentController(db)
-	userService := controllers.NewUserService(db)
+	paymentController := controllers.NewPaymentController(cfg, db, providers)
+	userService := controllers.NewUserService(db, tokens)
+	webhookController := controllers.NewWebhookController(cfg, db)
+	apiKeyController := controllers.NewAPIKeyController(db)
+	ldg := ledger.New(db)
+	adminController := controllers.NewAdminController(db, ldg)
+	accountController := controllers.NewAccountController(db)
+	transferController := controllers.NewTransferController(db)
+	providerController := controllers.NewProviderController(db, providers)
+	checkoutController := controllers.NewCheckoutController(cfg, db, providers, sender)
 	// API versioning middleware
 	apiRouter := router.PathPrefix("/v1").Subrouter()
 
@@ -86,45 +213,106 @@ func initRouter(db *database.Database) http.Handler {
 	apiRouter.Use(middleware.RequestLogger)
 	apiRouter.Use(middleware.RecoverPanic)
 	apiRouter.Use(middleware.ContentTypeJSON)
+	authenticated := middleware.Authenticate(tokens)
+	idempotent := middleware.Idempotency(db, cfg.Payments.IdempotencyKeyTTL.Duration)
+	// allowed checks the caller's role against the access policy
+	allowed := func(action string, handler http.Handler) http.Handler {
+		return authenticated(middleware.Authorize(auth.DefaultPolicy, db, action)(handler))
+	}
 	//account route
 	account := apiRouter.PathPrefix("/account").Subrouter()
-	account.HandleFunc("/register", func(w http.ResponseWriter, r *http.Request) {
-		var req struct {
-			Username string `json:"username"`
-			Password string `json:"password"`
-			Currency string `json:"currency"`
-		}
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-		user, err := userService.Register(req.Username, req.Password, req.Currency)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		json.NewEncoder(w).Encode(user)
-	}).Methods(http.MethodPost)
+	account.HandleFunc("/register", controllers.RegisterHandler(userService)).Methods(http.MethodPost)
+	account.HandleFunc("/login", controllers.LoginHandler(userService)).Methods(http.MethodPost)
+	account.HandleFunc("/refresh", controllers.RefreshHandler(userService)).Methods(http.MethodPost)
+	account.HandleFunc("/logout", controllers.LogoutHandler(userService)).Methods(http.MethodPost)
+	account.Handle("/me", authenticated(controllers.MeHandler(userService))).Methods(http.MethodGet)
+
+	// Accounts of the logged-in user
+	accounts := apiRouter.PathPrefix("/accounts").Subrouter()
+	accounts.Use(authenticated)
+	accounts.HandleFunc("", accountController.ListAccounts).Methods(http.MethodGet)
+	accounts.HandleFunc("", accountController.CreateAccount).Methods(http.MethodPost)
+	accounts.HandleFunc("/{id}", accountController.GetAccount).Methods(http.MethodGet)
+	accounts.HandleFunc("/{id}", accountController.UpdateAccount).Methods(http.MethodPatch)
+
+	// Transfers between accounts
+	transfers := apiRouter.PathPrefix("/transfers").Subrouter()
+	transfers.Use(authenticated)
+	transfers.Handle("", idempotent(http.HandlerFunc(transferController.CreateTransfer))).Methods(http.MethodPost)
+	transfers.HandleFunc("/{id}", transferController.GetTransfer).Methods(http.MethodGet)
 
-	// Public routes
+	// API key management, for the logged-in merchant
+	apiKeys := apiRouter.PathPrefix("/api-keys").Subrouter()
+	apiKeys.Handle("", allowed(auth.ActionManageAPIKeys, http.HandlerFunc(apiKeyController.CreateKey))).Methods(http.MethodPost)
+	apiKeys.Handle("", allowed(auth.ActionManageAPIKeys, http.HandlerFunc(apiKeyController.ListKeys))).Methods(http.MethodGet)
+	apiKeys.Handle("/{id}", allowed(auth.ActionManageAPIKeys, http.HandlerFunc(apiKeyController.RevokeKey))).Methods(http.MethodDelete)
+
+	// User administration
+	admin := apiRouter.PathPrefix("/admin").Subrouter()
+	admin.Handle("/users/{id}/role", allowed(auth.ActionManageRoles, http.HandlerFunc(adminController.SetUserRole))).Methods(http.MethodPut)
+	admin.Handle("/ledger/verify", allowed(auth.ActionVerifyLedger, http.HandlerFunc(adminController.VerifyLedger))).Methods(http.MethodGet)
+	admin.Handle("/limits", allowed(auth.ActionManageLimits, http.HandlerFunc(adminController.ListLimits))).Methods(http.MethodGet)
+	admin.Handle("/limits/{type}/{currency}", allowed(auth.ActionManageLimits, http.HandlerFunc(adminController.SetLimits))).Methods(http.MethodPut)
+	admin.Handle("/accounts/{id}/deposits", allowed(auth.ActionDeposit, idempotent(http.HandlerFunc(adminController.Deposit)))).Methods(http.MethodPost)
+
+	// Merchant routes, authenticated by API key and scoped per route
+	apiKey := middleware.APIKeyAuth(db)
+	scoped := func(scope string, handler http.Handler) http.Handler {
+		return apiKey(middleware.RequireScope(scope)(handler))
+	}
 	payments := apiRouter.PathPrefix("/payments").Subrouter()
-	payments.HandleFunc("/init", paymentController.InitializePayment).Methods(http.MethodPost)
-	payments.HandleFunc("/{id}/status", paymentController.GetPaymentStatus).Methods(http.MethodGet)
+	payments.Handle("/init", scoped(model.ScopePaymentsWrite, idempotent(http.HandlerFunc(paymentController.InitializePayment)))).Methods(http.MethodPost)
+	payments.Handle("/{id}/status", scoped(model.ScopePaymentsRead, http.HandlerFunc(paymentController.GetPaymentStatus))).Methods(http.MethodGet)
+	payments.Handle("/{id}/webhooks", scoped(model.ScopePaymentsRead, http.HandlerFunc(paymentController.GetPaymentWebhooks))).Methods(http.MethodGet)
+	payments.Handle("/{id}/cancel", scoped(model.ScopePaymentsWrite, http.HandlerFunc(paymentController.CancelPayment))).Methods(http.MethodPost)
+
+	// Mobile money simulation routes, for operators logged in with an access
+	// token or calling with a payments:confirm key. Both go through the role
+	// policy; for a key it is checked against the role of the key's owner.
+	operatorOnly := func(action string, handler http.Handler) http.Handler {
+		byToken := allowed(action, handler)
+		byKey := scoped(model.ScopePaymentsConfirm, middleware.AuthorizeAPIKey(auth.DefaultPolicy, db, action)(handler))
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("X-API-Key") != "" {
+				byKey.ServeHTTP(w, r)
+				return
+			}
+			byToken.ServeHTTP(w, r)
+		})
+	}
+	payments.Handle("/{id}/confirm", operatorOnly(auth.ActionConfirmPayment, http.HandlerFunc(paymentController.ConfirmPayment))).Methods(http.MethodPost)
+	payments.Handle("/{id}/reject", operatorOnly(auth.ActionRejectPayment, http.HandlerFunc(paymentController.RejectPayment))).Methods(http.MethodPost)
+
+	// Status callbacks from mobile money providers, authenticated by their signature
+	apiRouter.HandleFunc("/providers/{provider}/callback", providerController.HandleCallback).Methods(http.MethodPost)
+
+	// Webhook signing secrets and the hosts allowed in callback URLs
+	webhooks := apiRouter.PathPrefix("/webhooks").Subrouter()
+	webhooks.Handle("/secrets", scoped(model.ScopeWebhooksRead, http.HandlerFunc(webhookController.ListSecrets))).Methods(http.MethodGet)
+	webhooks.Handle("/secrets/rotate", scoped(model.ScopeWebhooksWrite, http.HandlerFunc(webhookController.RotateSecret))).Methods(http.MethodPost)
+	webhooks.Handle("/callback-hosts", scoped(model.ScopeWebhooksRead, http.HandlerFunc(webhookController.ListCallbackHosts))).Methods(http.MethodGet)
+	webhooks.Handle("/callback-hosts", scoped(model.ScopeWebhooksWrite, http.HandlerFunc(webhookController.AddCallbackHost))).Methods(http.MethodPost)
+	webhooks.Handle("/callback-hosts/{host}", scoped(model.ScopeWebhooksWrite, http.HandlerFunc(webhookController.RemoveCallbackHost))).Methods(http.MethodDelete)
 
-	// Mobile money simulation routes
-	payments.HandleFunc("/{id}/confirm", paymentController.ConfirmPayment).Methods(http.MethodPost)
-	payments.HandleFunc("/{id}/reject", paymentController.RejectPayment).Methods(http.MethodPost)
-	// Removed the cancel payment route since the method doesn't exist
+	// Hosted payment page, the payment URL returned by /v1/payments/init
+	checkout := router.PathPrefix("/pay").Subrouter()
+	checkout.Use(middleware.RequestLogger)
+	checkout.Use(middleware.RecoverPanic)
+	checkout.HandleFunc("/{id}", checkoutController.ShowCheckout).Methods(http.MethodGet)
+	checkout.HandleFunc("/{id}", checkoutController.ApproveCheckout).Methods(http.MethodPost)
 
 	// Health check endpoint
 	router.HandleFunc("/health", healthCheck).Methods(http.MethodGet)
 
+	// Prometheus metrics
+	router.Handle("/metrics", promhttp.Handler()).Methods(http.MethodGet)
+
 	// Configure CORS
 	c := cors.New(cors.Options{
-		AllowedOrigins:   []string{"*"}, // Update this for production
-		AllowedMethods:   []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodOptions},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedOrigins:   cfg.CORS.AllowedOrigins,
+		AllowedMethods:   []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "Idempotency-Key", "X-API-Key"},
+		ExposedHeaders:   []string{"Link", "Idempotent-Replayed"},
 		AllowCredentials: true,
 		MaxAge:           300,
 	})
@@ -138,7 +326,7 @@ func healthCheck(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(`{"status":"healthy"}`))
 }
 
-func gracefulShutdown(server *http.Server, log zerolog.Logger) {
+func gracefulShutdown(server *http.Server, workers []worker.Worker, shutdownTimeout time.Duration, log zerolog.Logger) {
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	sig := <-quit
@@ -153,12 +341,11 @@ func gracefulShutdown(server *http.Server, log zerolog.Logger) {
 		log.Fatal().Err(err).Msg("Could not gracefully shutdown the server")
 	}
 
-	log.Info().Msg("Server stopped")
-}
-
-func getEnvOrDefault(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+	for _, w := range workers {
+		if err := w.Stop(ctx); err != nil {
+			log.Error().Err(err).Msg("Could not gracefully stop worker")
+		}
 	}
-	return defaultValue
+
+	log.Info().Msg("Server stopped")
 }
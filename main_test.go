@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"payment-server/auth"
+	"payment-server/config"
+	"payment-server/database"
+	"payment-server/model"
+	"payment-server/webhook"
+	"payment-server/worker"
+	"sync"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+// testServer runs the API router over a MemoryStore
+type testServer struct {
+	*httptest.Server
+	cfg    *config.Config
+	db     *database.MemoryStore
+	sender *webhook.Sender
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	cfg := config.Default()
+	cfg.Database.Driver = "memory"
+
+	db := database.NewMemoryStore()
+	tokens := auth.NewTokenManager(cfg.Auth, "test-jwt-secret-0123456789abcdef")
+	sender := webhook.NewSender(cfg.Webhooks.Timeout.Duration, db)
+	server := httptest.NewServer(initRouter(cfg, db, tokens, initProviders(cfg, zerolog.Nop()), sender))
+	t.Cleanup(server.Close)
+	return &testServer{Server: server, cfg: cfg, db: db, sender: sender}
+}
+
+// call sends body as JSON with the given headers and decodes the JSON
+// response into out, failing the test unless the status is want
+func (s *testServer) call(t *testing.T, method, path string, headers map[string]string, body, out any, want int) {
+	t.Helper()
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, s.URL+path, reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != want {
+		t.Fatalf("%s %s = %d %s, want %d", method, path, resp.StatusCode, data, want)
+	}
+	if out != nil {
+		if err := json.Unmarshal(data, out); err != nil {
+			t.Fatalf("%s %s: decode %s: %v", method, path, data, err)
+		}
+	}
+}
+
+// login registers a user with role, promoting it in the store when the
+// role cannot be registered for, and returns its ID and access token
+func (s *testServer) login(t *testing.T, username, role string) (string, string) {
+	t.Helper()
+	registerRole := role
+	if role != model.RoleCustomer && role != model.RoleMerchant {
+		registerRole = model.RoleCustomer
+	}
+	var registered struct {
+		ID string `json:"id"`
+	}
+	s.call(t, http.MethodPost, "/v1/account/register", nil, map[string]string{
+		"username": username, "password": "secret123!", "currency": "XOF", "role": registerRole,
+	}, &registered, http.StatusCreated)
+	if role != registerRole {
+		if err := s.db.UpdateUserRole(context.Background(), registered.ID, role); err != nil {
+			t.Fatalf("UpdateUserRole: %v", err)
+		}
+	}
+
+	var tokens struct {
+		AccessToken string `json:"access_token"`
+	}
+	s.call(t, http.MethodPost, "/v1/account/login", nil, map[string]string{
+		"username": username, "password": "secret123!",
+	}, &tokens, http.StatusOK)
+	return registered.ID, tokens.AccessToken
+}
+
+// receivedWebhook is a delivery captured by the merchant's endpoint
+type receivedWebhook struct {
+	header http.Header
+	body   []byte
+}
+
+// TestPaymentFlow creates a payment as a merchant, confirms it as an
+// operator and checks the signed payment.updated webhook the merchant
+// receives
+func TestPaymentFlow(t *testing.T) {
+	s := newTestServer(t)
+
+	var mu sync.Mutex
+	var received []receivedWebhook
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		received = append(received, receivedWebhook{header: r.Header.Clone(), body: body})
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	merchantID, merchantToken := s.login(t, "merchant1", model.RoleMerchant)
+	_, operatorToken := s.login(t, "operator1", model.RoleOperator)
+
+	var keys model.APIKeysResponse
+	s.call(t, http.MethodPost, "/v1/api-keys", map[string]string{"Authorization": "Bearer " + merchantToken}, model.APIKeyRequest{
+		Name:   "checkout",
+		Scopes: []string{model.ScopePaymentsWrite, model.ScopePaymentsRead, model.ScopeWebhooksWrite},
+	}, &keys, http.StatusCreated)
+	merchantKey := map[string]string{"X-API-Key": keys.Keys[0].Key}
+
+	// The secret provisioned at registration is never shown, so the
+	// merchant rotates to learn one
+	var secrets model.WebhookSecretsResponse
+	s.call(t, http.MethodPost, "/v1/webhooks/secrets/rotate", merchantKey, nil, &secrets, http.StatusCreated)
+	secret := secrets.Secrets[0].Secret
+
+	var created model.TransactionResponse
+	s.call(t, http.MethodPost, "/v1/payments/init", merchantKey, map[string]any{
+		"amount":      map[string]string{"value": "1500", "currency": "XOF"},
+		"payer_phone": "+221770000003",
+		"webhook_url": receiver.URL,
+	}, &created, http.StatusCreated)
+	payment := created.Transaction
+	if payment.Status != model.StatusPending || payment.MerchantID != merchantID || payment.Provider != "simulator" {
+		t.Fatalf("created payment = %+v, want a pending simulator payment of %s", payment, merchantID)
+	}
+
+	// Merchants cannot confirm their own payments
+	s.call(t, http.MethodPost, "/v1/payments/"+payment.ID+"/confirm", map[string]string{"Authorization": "Bearer " + merchantToken}, nil, nil, http.StatusForbidden)
+
+	var confirmed model.TransactionResponse
+	s.call(t, http.MethodPost, "/v1/payments/"+payment.ID+"/confirm", map[string]string{"Authorization": "Bearer " + operatorToken}, nil, &confirmed, http.StatusOK)
+	if confirmed.Transaction.Status != model.StatusSuccess {
+		t.Fatalf("confirmed payment has status %s", confirmed.Transaction.Status)
+	}
+
+	var status model.TransactionResponse
+	s.call(t, http.MethodGet, "/v1/payments/"+payment.ID+"/status", merchantKey, nil, &status, http.StatusOK)
+	if status.Transaction.Status != model.StatusSuccess {
+		t.Fatalf("payment status = %s, want success", status.Transaction.Status)
+	}
+
+	dispatcher := worker.NewWebhookDispatcher(s.db, s.sender, s.cfg.Webhooks)
+	if _, err := dispatcher.Dispatch(context.Background()); err != nil {
+		t.Fatalf("Dispatch: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	var updated *model.WebhookPayload
+	for _, delivery := range received {
+		if err := webhook.Verify(delivery.body, delivery.header.Get(webhook.SignatureHeader), secret, webhook.DefaultTolerance); err != nil {
+			t.Fatalf("webhook %s does not verify with the merchant's secret: %v", delivery.body, err)
+		}
+		var payload model.WebhookPayload
+		if err := json.Unmarshal(delivery.body, &payload); err != nil {
+			t.Fatalf("decode webhook %s: %v", delivery.body, err)
+		}
+		if payload.Data.ID == payment.ID && payload.Data.Status == model.StatusSuccess {
+			updated = &payload
+		}
+	}
+	if updated == nil {
+		t.Fatalf("no webhook reported the payment as successful, got %d deliveries", len(received))
+	}
+	if updated.EventType != model.EventPaymentUpdated {
+		t.Fatalf("webhook event type = %s, want payment.updated", updated.EventType)
+	}
+
+	events, err := s.db.ListWebhookEvents(context.Background(), payment.ID)
+	if err != nil {
+		t.Fatalf("ListWebhookEvents: %v", err)
+	}
+	for _, event := range events {
+		if event.Status != model.WebhookDelivered {
+			t.Fatalf("webhook event %s is %s, want delivered", event.ID, event.Status)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+// Package metrics defines the server's Prometheus counters. They are
+// registered with the default registry, which main serves on /metrics for
+// prometheus.yml to scrape.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// How a provider status reached us, the source label of PaymentsResolved
+const (
+	SourceCallback = "callback"
+	SourcePolling  = "polling"
+	// SourceCheckout is a status queried when the payer approved on the
+	// hosted payment page
+	SourceCheckout = "checkout"
+)
+
+var (
+	// PaymentsResolved counts payments settled from a status reported by
+	// their provider
+	PaymentsResolved = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "realpay_payments_resolved_total",
+		Help: "Payments settled from a status reported by their provider, by how the status was learned.",
+	}, []string{"source", "status"})
+	// StatusQueries counts the reconciler's status queries to providers
+	StatusQueries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "realpay_provider_status_queries_total",
+		Help: "Status queries made by the reconciler to providers, by outcome.",
+	}, []string{"provider", "result"})
+)
@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"payment-server/auth"
+	"payment-server/model"
+	"payment-server/utils"
+
+	"github.com/rs/zerolog/log"
+)
+
+const apiKeyKey contextKey = "apiKey"
+
+// APIKeyStore looks up API keys by their public prefix
+type APIKeyStore interface {
+	GetAPIKeyByPrefix(ctx context.Context, prefix string) (*model.APIKey, error)
+}
+
+// APIKeyAuth rejects requests without a valid, unrevoked X-API-Key header
+// and stores the key in the request context for RequireScope and ClientID
+func APIKeyAuth(store APIKeyStore) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			value := r.Header.Get("X-API-Key")
+			if value == "" {
+				utils.SendError(w, "X-API-Key header is required", http.StatusUnauthorized)
+				return
+			}
+			prefix, ok := auth.SplitAPIKey(value)
+			if !ok {
+				utils.SendError(w, "Invalid API key", http.StatusUnauthorized)
+				return
+			}
+
+			key, err := store.GetAPIKeyByPrefix(r.Context(), prefix)
+			if err != nil {
+				log.Error().Err(err).Str("prefix", prefix).Msg("Failed to load API key")
+				utils.SendError(w, "Failed to authenticate request", http.StatusInternalServerError)
+				return
+			}
+			if key == nil || key.RevokedAt != nil ||
+				subtle.ConstantTimeCompare([]byte(key.KeyHash), []byte(auth.HashAPIKey(value))) != 1 {
+				utils.SendError(w, "Invalid API key", http.StatusUnauthorized)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), apiKeyKey, key)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// RequireScope rejects requests whose API key does not grant scope. It must
+// run after APIKeyAuth.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := APIKey(r.Context())
+			if key == nil {
+				utils.SendError(w, "X-API-Key header is required", http.StatusUnauthorized)
+				return
+			}
+			if !key.HasScope(scope) {
+				utils.SendError(w, "API key is missing the "+scope+" scope", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// APIKey returns the key authenticated by APIKeyAuth, or nil
+func APIKey(ctx context.Context) *model.APIKey {
+	key, _ := ctx.Value(apiKeyKey).(*model.APIKey)
+	return key
+}
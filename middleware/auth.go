@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"payment-server/auth"
+	"payment-server/utils"
+	"strings"
+)
+
+type contextKey string
+
+const (
+	userIDKey contextKey = "userID"
+	roleKey   contextKey = "role"
+)
+
+// AccessTokenParser verifies bearer access tokens
+type AccessTokenParser interface {
+	ParseAccessToken(token string) (*auth.Claims, error)
+}
+
+// Authenticate rejects requests without a valid "Authorization: Bearer"
+// access token and stores the token's user ID and role in the request context
+func Authenticate(tokens AccessTokenParser) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+			if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				utils.SendError(w, "Missing bearer token", http.StatusUnauthorized)
+				return
+			}
+
+			claims, err := tokens.ParseAccessToken(strings.TrimSpace(token))
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				utils.SendError(w, "Invalid or expired access token", http.StatusUnauthorized)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), userIDKey, claims.Subject)
+			ctx = context.WithValue(ctx, roleKey, claims.Role)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// UserID returns the authenticated user's ID, or "" outside Authenticate
+func UserID(ctx context.Context) string {
+	id, _ := ctx.Value(userIDKey).(string)
+	return id
+}
+
+// Role returns the authenticated user's role, or "" outside Authenticate
+func Role(ctx context.Context) string {
+	role, _ := ctx.Value(roleKey).(string)
+	return role
+}
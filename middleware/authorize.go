@@ -0,0 +1,126 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"payment-server/auth"
+	"payment-server/model"
+	"payment-server/utils"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// AuditStore records audit log entries
+type AuditStore interface {
+	CreateAuditLog(ctx context.Context, entry *model.AuditLog) error
+}
+
+// RoleStore records audit log entries and looks up the current role of users
+type RoleStore interface {
+	AuditStore
+	GetUserByID(ctx context.Context, id string) (*model.User, error)
+}
+
+// Authorize lets the request through only if policy allows the current role
+// of the authenticated user to perform action. The role is loaded from store
+// rather than taken from the access token, so a demotion applies at once.
+// Denials are written to the audit log. It must run after Authenticate.
+func Authorize(policy auth.Policy, store RoleStore, action string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID := UserID(r.Context())
+			if userID == "" {
+				utils.SendError(w, "Missing bearer token", http.StatusUnauthorized)
+				return
+			}
+
+			role, ok := authorizeUser(w, r, policy, store, userID, action)
+			if !ok {
+				return
+			}
+			ctx := context.WithValue(r.Context(), roleKey, role)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// AuthorizeAPIKey is Authorize for API keys: it lets the request through only
+// if policy allows the current role of the user owning the key to perform
+// action, so that a key cannot do more than its owner. It must run after
+// APIKeyAuth.
+func AuthorizeAPIKey(policy auth.Policy, store RoleStore, action string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := APIKey(r.Context())
+			if key == nil {
+				utils.SendError(w, "X-API-Key header is required", http.StatusUnauthorized)
+				return
+			}
+
+			if _, ok := authorizeUser(w, r, policy, store, key.MerchantID, action); ok {
+				next.ServeHTTP(w, r)
+			}
+		})
+	}
+}
+
+// authorizeUser checks the current role of userID against policy, answering
+// the request and returning false when it is denied. A deleted user has no
+// role and is denied.
+func authorizeUser(w http.ResponseWriter, r *http.Request, policy auth.Policy, store RoleStore, userID, action string) (string, bool) {
+	user, err := store.GetUserByID(r.Context(), userID)
+	if err != nil {
+		log.Error().Err(err).Str("userID", userID).Msg("Failed to load user role")
+		utils.SendError(w, "Failed to authorize request", http.StatusInternalServerError)
+		return "", false
+	}
+	role := ""
+	if user != nil {
+		role = user.Role
+	}
+	if !policy.Allows(role, action) {
+		recordDenial(r, store, userID, role, action)
+		utils.SendError(w, "You are not allowed to perform this action", http.StatusForbidden)
+		return "", false
+	}
+	return role, true
+}
+
+func recordDenial(r *http.Request, audit AuditStore, userID, role, action string) {
+	changes, _ := json.Marshal(map[string]string{
+		"action": action,
+		"role":   role,
+		"method": r.Method,
+		"path":   r.URL.Path,
+	})
+	entry := &model.AuditLog{
+		ID:         utils.GenerateID(),
+		EntityType: "action",
+		EntityID:   action,
+		Action:     model.AuditAccessDenied,
+		ActorID:    userID,
+		ActorType:  "user",
+		Changes:    changes,
+		IPAddress:  RemoteIP(r),
+		UserAgent:  r.UserAgent(),
+		CreatedAt:  time.Now(),
+	}
+
+	// A failed audit write must not turn the denial into a server error
+	if err := audit.CreateAuditLog(context.WithoutCancel(r.Context()), entry); err != nil {
+		log.Error().Err(err).Str("userID", userID).Str("action", action).Msg("Failed to record access denial")
+	}
+	log.Warn().Str("userID", userID).Str("role", role).Str("action", action).Msg("Access denied")
+}
+
+// RemoteIP is the client address of the request without its port
+func RemoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return ""
+	}
+	return host
+}
@@ -0,0 +1,135 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"payment-server/model"
+	"payment-server/utils"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const maxIdempotencyKeyLength = 255
+
+// IdempotencyStore persists Idempotency-Key reservations and responses
+type IdempotencyStore interface {
+	ReserveIdempotencyKey(ctx context.Context, record *model.IdempotencyRecord) (*model.IdempotencyRecord, error)
+	SaveIdempotencyResponse(ctx context.Context, clientID, key string, statusCode int, body []byte) error
+	ReleaseIdempotencyKey(ctx context.Context, clientID, key string) error
+}
+
+// Idempotency replays the stored response when a request is retried with
+// the same Idempotency-Key and body. Reusing a key with a different body is
+// rejected with 422. Keys are scoped per client and expire after ttl.
+func Idempotency(store IdempotencyStore, ttl time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get("Idempotency-Key")
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > maxIdempotencyKeyLength {
+				utils.SendError(w, "Idempotency-Key must be at most 255 characters", http.StatusBadRequest)
+				return
+			}
+
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				utils.SendError(w, "Invalid request format", http.StatusBadRequest)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			// The outcome must be recorded even if the client hangs up
+			ctx := context.WithoutCancel(r.Context())
+			now := time.Now()
+			record := &model.IdempotencyRecord{
+				ClientID:    ClientID(r),
+				Key:         key,
+				Fingerprint: fingerprint(r, body),
+				CreatedAt:   now,
+				ExpiresAt:   now.Add(ttl),
+			}
+
+			existing, err := store.ReserveIdempotencyKey(ctx, record)
+			if err != nil {
+				log.Error().Err(err).Str("idempotencyKey", key).Msg("Failed to reserve idempotency key")
+				utils.SendError(w, "Failed to process transaction", http.StatusInternalServerError)
+				return
+			}
+			if existing != nil {
+				replay(w, existing, record.Fingerprint)
+				return
+			}
+
+			completed := false
+			defer func() {
+				// Free the key when the handler panicked so the client can retry
+				if !completed {
+					if err := store.ReleaseIdempotencyKey(ctx, record.ClientID, key); err != nil {
+						log.Error().Err(err).Str("idempotencyKey", key).Msg("Failed to release idempotency key")
+					}
+				}
+			}()
+
+			rec := &captureWriter{ResponseWriter: w, statusCode: http.StatusOK}
+			next.ServeHTTP(rec, r)
+
+			// Server errors are not cached so that a retry can succeed
+			if rec.statusCode >= http.StatusInternalServerError {
+				return
+			}
+			if err := store.SaveIdempotencyResponse(ctx, record.ClientID, key, rec.statusCode, rec.body.Bytes()); err != nil {
+				log.Error().Err(err).Str("idempotencyKey", key).Msg("Failed to save idempotent response")
+				return
+			}
+			completed = true
+		})
+	}
+}
+
+func replay(w http.ResponseWriter, existing *model.IdempotencyRecord, fingerprint string) {
+	if existing.Fingerprint != fingerprint {
+		utils.SendError(w, "Idempotency-Key was already used with a different request body", http.StatusUnprocessableEntity)
+		return
+	}
+	if existing.StatusCode == 0 {
+		utils.SendError(w, "A request with this Idempotency-Key is still being processed", http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(existing.StatusCode)
+	w.Write(existing.Body)
+}
+
+func fingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// captureWriter passes the response through while keeping a copy of it
+type captureWriter struct {
+	http.ResponseWriter
+	statusCode int
+	body       bytes.Buffer
+}
+
+func (cw *captureWriter) WriteHeader(code int) {
+	cw.statusCode = code
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+func (cw *captureWriter) Write(b []byte) (int, error) {
+	cw.body.Write(b)
+	return cw.ResponseWriter.Write(b)
+}
@@ -59,6 +59,15 @@ func ContentTypeJSON(next http.Handler) http.Handler {
 	})
 }
 
+// ClientID identifies the caller: the merchant whose API key authenticated
+// the request, or else the logged-in user. It is empty for anonymous callers.
+func ClientID(r *http.Request) string {
+	if key := APIKey(r.Context()); key != nil {
+		return key.MerchantID
+	}
+	return UserID(r.Context())
+}
+
 // responseWriter is a custom response writer that captures the status code
 type responseWriter struct {
 	http.ResponseWriter
@@ -0,0 +1,4 @@
+-- migrations/000003_payment_transactions.down.sql
+DROP INDEX IF EXISTS idx_payment_transactions_reference;
+DROP INDEX IF EXISTS idx_payment_transactions_status;
+DROP TABLE IF EXISTS payment_transactions;
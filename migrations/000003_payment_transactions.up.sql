@@ -0,0 +1,20 @@
+-- migrations/000003_payment_transactions.up.sql
+-- Mobile money payment transactions, kept apart from the ledger transactions table
+CREATE TABLE IF NOT EXISTS payment_transactions (
+    id VARCHAR(64) PRIMARY KEY,
+    amount DECIMAL(10,2) NOT NULL,
+    currency VARCHAR(3) NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL,
+    payer_phone VARCHAR(20) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    reference VARCHAR(255) NOT NULL DEFAULT '',
+    webhook_url TEXT NOT NULL DEFAULT '',
+    callback_success TEXT NOT NULL DEFAULT '',
+    callback_error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_payment_transactions_status ON payment_transactions(status);
+CREATE INDEX IF NOT EXISTS idx_payment_transactions_reference ON payment_transactions(reference);
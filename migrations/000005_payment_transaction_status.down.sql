@@ -0,0 +1,2 @@
+-- migrations/000005_payment_transaction_status.down.sql
+ALTER TABLE payment_transactions DROP CONSTRAINT IF EXISTS valid_payment_transaction_status;
@@ -0,0 +1,6 @@
+-- migrations/000005_payment_transaction_status.up.sql
+-- Mirrors the statuses of the state machine in model/state.go
+ALTER TABLE payment_transactions
+    ADD CONSTRAINT valid_payment_transaction_status CHECK (status IN (
+        'pending', 'processing', 'success', 'error', 'cancelled', 'expired', 'refunded'
+    ));
@@ -0,0 +1,2 @@
+-- migrations/000006_payment_cancellation_reason.down.sql
+ALTER TABLE payment_transactions DROP COLUMN IF EXISTS cancellation_reason;
@@ -0,0 +1,2 @@
+-- migrations/000006_payment_cancellation_reason.up.sql
+ALTER TABLE payment_transactions ADD COLUMN IF NOT EXISTS cancellation_reason TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+-- migrations/000007_payment_transactions_expiry_index.down.sql
+DROP INDEX IF EXISTS idx_payment_transactions_status_expires_at;
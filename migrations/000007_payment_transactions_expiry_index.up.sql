@@ -0,0 +1,3 @@
+-- migrations/000007_payment_transactions_expiry_index.up.sql
+-- Supports the expiry sweeper's lookup of overdue pending transactions
+CREATE INDEX IF NOT EXISTS idx_payment_transactions_status_expires_at ON payment_transactions(status, expires_at);
@@ -0,0 +1,3 @@
+-- migrations/000008_webhook_outbox.down.sql
+DROP TABLE IF EXISTS webhook_delivery_attempts;
+DROP TABLE IF EXISTS webhook_outbox;
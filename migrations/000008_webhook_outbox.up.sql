@@ -0,0 +1,34 @@
+-- migrations/000008_webhook_outbox.up.sql
+-- Transactional outbox for merchant webhooks, written in the same database
+-- transaction as the payment status change that produced the event
+CREATE TABLE IF NOT EXISTS webhook_outbox (
+    id VARCHAR(64) PRIMARY KEY,
+    transaction_id VARCHAR(64) NOT NULL REFERENCES payment_transactions(id) ON DELETE CASCADE,
+    event_type VARCHAR(50) NOT NULL,
+    url TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    delivered_at TIMESTAMP,
+    CONSTRAINT valid_webhook_status CHECK (status IN ('pending', 'delivered', 'dead'))
+);
+
+-- One row per delivery attempt
+CREATE TABLE IF NOT EXISTS webhook_delivery_attempts (
+    id BIGSERIAL PRIMARY KEY,
+    event_id VARCHAR(64) NOT NULL REFERENCES webhook_outbox(id) ON DELETE CASCADE,
+    attempt INTEGER NOT NULL,
+    status_code INTEGER NOT NULL DEFAULT 0,
+    latency_ms BIGINT NOT NULL DEFAULT 0,
+    response_snippet TEXT NOT NULL DEFAULT '',
+    error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (event_id, attempt)
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_outbox_due ON webhook_outbox(status, next_attempt_at);
+CREATE INDEX IF NOT EXISTS idx_webhook_outbox_transaction ON webhook_outbox(transaction_id);
@@ -0,0 +1,5 @@
+-- migrations/000009_webhook_signing.down.sql
+DROP TABLE IF EXISTS webhook_secrets;
+DROP INDEX IF EXISTS idx_payment_transactions_merchant;
+ALTER TABLE webhook_outbox DROP COLUMN IF EXISTS merchant_id;
+ALTER TABLE payment_transactions DROP COLUMN IF EXISTS merchant_id;
@@ -0,0 +1,15 @@
+-- migrations/000009_webhook_signing.up.sql
+-- Merchant ownership of payments and per-merchant webhook signing secrets
+ALTER TABLE payment_transactions ADD COLUMN IF NOT EXISTS merchant_id VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE webhook_outbox ADD COLUMN IF NOT EXISTS merchant_id VARCHAR(255) NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS webhook_secrets (
+    id VARCHAR(64) PRIMARY KEY,
+    merchant_id VARCHAR(255) NOT NULL,
+    secret VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_payment_transactions_merchant ON payment_transactions(merchant_id);
+CREATE INDEX IF NOT EXISTS idx_webhook_secrets_merchant ON webhook_secrets(merchant_id, created_at);
@@ -0,0 +1,2 @@
+-- migrations/000010_refresh_tokens.down.sql
+DROP TABLE IF EXISTS refresh_tokens;
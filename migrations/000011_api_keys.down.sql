@@ -0,0 +1,2 @@
+-- migrations/000011_api_keys.down.sql
+DROP TABLE IF EXISTS api_keys;
@@ -0,0 +1,14 @@
+-- migrations/000011_api_keys.up.sql
+-- Merchant API keys, stored as SHA-256 hashes and looked up by public prefix
+CREATE TABLE IF NOT EXISTS api_keys (
+    id VARCHAR(64) PRIMARY KEY,
+    merchant_id VARCHAR(255) NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    prefix VARCHAR(32) UNIQUE NOT NULL,
+    key_hash VARCHAR(64) NOT NULL,
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    revoked_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_keys_merchant ON api_keys(merchant_id, created_at);
@@ -0,0 +1,12 @@
+-- migrations/000012_user_roles.down.sql
+DELETE FROM audit_logs WHERE action IN ('access_denied', 'role_change');
+
+ALTER TABLE audit_logs DROP CONSTRAINT IF EXISTS valid_action;
+ALTER TABLE audit_logs ADD CONSTRAINT valid_action CHECK (action IN (
+    'create', 'update', 'delete', 'suspend', 'activate',
+    'verify', 'login', 'logout', 'transfer', 'limit_change'
+));
+ALTER TABLE audit_logs ALTER COLUMN entity_id TYPE UUID USING entity_id::uuid;
+
+ALTER TABLE users DROP CONSTRAINT IF EXISTS valid_user_role;
+ALTER TABLE users DROP COLUMN IF EXISTS role;
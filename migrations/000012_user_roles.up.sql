@@ -0,0 +1,15 @@
+-- migrations/000012_user_roles.up.sql
+-- User roles, and audit log entries for denied requests and role changes
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'customer';
+ALTER TABLE users DROP CONSTRAINT IF EXISTS valid_user_role;
+ALTER TABLE users ADD CONSTRAINT valid_user_role CHECK (role IN ('customer', 'merchant', 'operator', 'admin'));
+
+-- Denials are recorded against payment IDs and actions, which are not UUIDs
+ALTER TABLE audit_logs ALTER COLUMN entity_id TYPE VARCHAR(255) USING entity_id::text;
+
+ALTER TABLE audit_logs DROP CONSTRAINT IF EXISTS valid_action;
+ALTER TABLE audit_logs ADD CONSTRAINT valid_action CHECK (action IN (
+    'create', 'update', 'delete', 'suspend', 'activate',
+    'verify', 'login', 'logout', 'transfer', 'limit_change',
+    'access_denied', 'role_change'
+));
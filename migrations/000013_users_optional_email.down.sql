@@ -0,0 +1,2 @@
+-- migrations/000013_users_optional_email.down.sql
+ALTER TABLE users ALTER COLUMN email SET NOT NULL;
@@ -0,0 +1,3 @@
+-- migrations/000013_users_optional_email.up.sql
+-- Registration only asks for a username and password
+ALTER TABLE users ALTER COLUMN email DROP NOT NULL;
@@ -0,0 +1,4 @@
+-- migrations/000014_ledger_journal.down.sql
+DROP INDEX IF EXISTS idx_transactions_journal;
+ALTER TABLE transactions DROP CONSTRAINT IF EXISTS nonzero_amount;
+ALTER TABLE transactions DROP COLUMN IF EXISTS journal_id;
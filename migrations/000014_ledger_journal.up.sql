@@ -0,0 +1,8 @@
+-- migrations/000014_ledger_journal.up.sql
+-- Group ledger postings into balanced journal entries. Amounts are signed:
+-- positive postings credit the account, negative ones debit it.
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS journal_id UUID;
+ALTER TABLE transactions DROP CONSTRAINT IF EXISTS nonzero_amount;
+ALTER TABLE transactions ADD CONSTRAINT nonzero_amount CHECK (amount <> 0);
+
+CREATE INDEX IF NOT EXISTS idx_transactions_journal ON transactions(journal_id);
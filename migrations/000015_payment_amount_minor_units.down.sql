@@ -0,0 +1,3 @@
+-- migrations/000015_payment_amount_minor_units.down.sql
+ALTER TABLE payment_transactions ALTER COLUMN amount TYPE DECIMAL(10,2)
+    USING amount::DECIMAL / CASE WHEN currency IN ('XOF', 'JPY') THEN 1 ELSE 100 END;
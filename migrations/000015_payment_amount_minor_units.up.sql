@@ -0,0 +1,5 @@
+-- migrations/000015_payment_amount_minor_units.up.sql
+-- Store payment amounts as integer minor units like every other amount.
+-- XOF and JPY have no minor unit; the other currencies have two decimals.
+ALTER TABLE payment_transactions ALTER COLUMN amount TYPE BIGINT
+    USING (amount * CASE WHEN currency IN ('XOF', 'JPY') THEN 1 ELSE 100 END)::BIGINT;
@@ -0,0 +1,2 @@
+-- migrations/000016_supported_currency_registry.down.sql
+ALTER TYPE supported_currency ADD VALUE IF NOT EXISTS 'N' AFTER 'XOF';
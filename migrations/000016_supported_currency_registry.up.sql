@@ -0,0 +1,18 @@
+-- migrations/000016_supported_currency_registry.up.sql
+-- Rebuild supported_currency from the currency package, which drops the
+-- bogus 'N' label. Postgres cannot remove an enum label in place, so every
+-- column is moved to a new type. The CREATE TYPE statement is the output of
+-- `realpay currency-enum`.
+ALTER TYPE supported_currency RENAME TO supported_currency_old;
+
+CREATE TYPE supported_currency AS ENUM ('USD', 'EUR', 'GBP', 'JPY', 'CNY', 'SGD', 'XOF', 'CHF', 'HKD', 'NZD');
+
+ALTER TABLE account_limits ALTER COLUMN currency TYPE supported_currency USING currency::text::supported_currency;
+ALTER TABLE accounts ALTER COLUMN currency TYPE supported_currency USING currency::text::supported_currency;
+ALTER TABLE payments ALTER COLUMN currency TYPE supported_currency USING currency::text::supported_currency;
+ALTER TABLE transactions ALTER COLUMN currency TYPE supported_currency USING currency::text::supported_currency;
+ALTER TABLE exchange_rates
+    ALTER COLUMN from_currency TYPE supported_currency USING from_currency::text::supported_currency,
+    ALTER COLUMN to_currency TYPE supported_currency USING to_currency::text::supported_currency;
+
+DROP TYPE supported_currency_old;
@@ -0,0 +1,4 @@
+-- migrations/000017_payment_providers.down.sql
+DROP INDEX IF EXISTS idx_payment_transactions_provider_reference;
+ALTER TABLE payment_transactions DROP COLUMN IF EXISTS provider_reference;
+ALTER TABLE payment_transactions DROP COLUMN IF EXISTS provider;
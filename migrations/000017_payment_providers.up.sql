@@ -0,0 +1,6 @@
+-- migrations/000017_payment_providers.up.sql
+-- The mobile money provider collecting each payment and its ID there
+ALTER TABLE payment_transactions ADD COLUMN IF NOT EXISTS provider VARCHAR(32) NOT NULL DEFAULT '';
+ALTER TABLE payment_transactions ADD COLUMN IF NOT EXISTS provider_reference VARCHAR(255) NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_payment_transactions_provider_reference ON payment_transactions(provider, provider_reference);
@@ -0,0 +1,4 @@
+-- migrations/000018_provider_status_queries.down.sql
+DROP INDEX IF EXISTS idx_payment_transactions_status_query;
+ALTER TABLE payment_transactions DROP COLUMN IF EXISTS next_status_query_at;
+ALTER TABLE payment_transactions DROP COLUMN IF EXISTS status_queries;
@@ -0,0 +1,6 @@
+-- migrations/000018_provider_status_queries.up.sql
+-- Backoff state of the reconciler polling providers for pending payments
+ALTER TABLE payment_transactions ADD COLUMN IF NOT EXISTS status_queries INT NOT NULL DEFAULT 0;
+ALTER TABLE payment_transactions ADD COLUMN IF NOT EXISTS next_status_query_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_payment_transactions_status_query ON payment_transactions(status, next_status_query_at);
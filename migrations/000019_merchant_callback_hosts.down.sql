@@ -0,0 +1,2 @@
+-- migrations/000019_merchant_callback_hosts.down.sql
+DROP TABLE IF EXISTS merchant_callback_hosts;
@@ -0,0 +1,8 @@
+-- migrations/000019_merchant_callback_hosts.up.sql
+-- Hosts each merchant allows in the callback URLs of its payments
+CREATE TABLE IF NOT EXISTS merchant_callback_hosts (
+    merchant_id VARCHAR(255) NOT NULL,
+    host VARCHAR(253) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (merchant_id, host)
+);
@@ -0,0 +1,43 @@
+-- migrations/000020_audit_log_trigger.down.sql
+-- Restores the trigger of the initial schema, which fails on every insert.
+-- The system user stays: deleting it would be audited against itself.
+CREATE OR REPLACE FUNCTION audit_log_changes()
+RETURNS TRIGGER AS $$
+DECLARE
+    changes_json JSONB;
+    actor_id UUID;
+BEGIN
+    actor_id := NULLIF(current_setting('app.current_user_id', TRUE), '');
+
+    IF TG_OP = 'INSERT' THEN
+        changes_json := jsonb_build_object('new', row_to_json(NEW));
+    ELSIF TG_OP = 'UPDATE' THEN
+        changes_json := jsonb_build_object(
+            'old', row_to_json(OLD),
+            'new', row_to_json(NEW)
+        );
+    ELSE
+        changes_json := jsonb_build_object('old', row_to_json(OLD));
+    END IF;
+
+    INSERT INTO audit_logs (
+        entity_type,
+        entity_id,
+        action,
+        actor_id,
+        actor_type,
+        changes,
+        ip_address
+    ) VALUES (
+        TG_TABLE_NAME,
+        COALESCE(NEW.id, OLD.id),
+        LOWER(TG_OP),
+        actor_id,
+        'user',
+        changes_json,
+        NULLIF(current_setting('app.current_ip_address', TRUE), '')::INET
+    );
+
+    RETURN NULL;
+END;
+$$ language 'plpgsql';
@@ -0,0 +1,61 @@
+-- migrations/000020_audit_log_trigger.up.sql
+-- The audit trigger of the initial schema logged LOWER(TG_OP), which the
+-- valid_action constraint rejects, and a NULL actor whenever the session had
+-- not set app.current_user_id, which actor_id forbids, so every insert into
+-- users, accounts and payments failed. Log the operations as create, update
+-- and delete, and attribute changes made outside a user session to a system
+-- user that cannot log in.
+CREATE OR REPLACE FUNCTION audit_log_changes()
+RETURNS TRIGGER AS $$
+DECLARE
+    changes_json JSONB;
+    entity_id UUID;
+    actor_id UUID;
+    actor_type VARCHAR(50) := 'user';
+BEGIN
+    actor_id := NULLIF(current_setting('app.current_user_id', TRUE), '');
+    IF actor_id IS NULL THEN
+        actor_id := '00000000-0000-0000-0000-000000000000';
+        actor_type := 'system';
+    END IF;
+
+    IF TG_OP = 'INSERT' THEN
+        entity_id := NEW.id;
+        changes_json := jsonb_build_object('new', row_to_json(NEW));
+    ELSIF TG_OP = 'UPDATE' THEN
+        entity_id := NEW.id;
+        changes_json := jsonb_build_object(
+            'old', row_to_json(OLD),
+            'new', row_to_json(NEW)
+        );
+    ELSE
+        entity_id := OLD.id;
+        changes_json := jsonb_build_object('old', row_to_json(OLD));
+    END IF;
+
+    INSERT INTO audit_logs (
+        entity_type,
+        entity_id,
+        action,
+        actor_id,
+        actor_type,
+        changes,
+        ip_address
+    ) VALUES (
+        TG_TABLE_NAME,
+        entity_id,
+        CASE TG_OP WHEN 'INSERT' THEN 'create' WHEN 'UPDATE' THEN 'update' ELSE 'delete' END,
+        actor_id,
+        actor_type,
+        changes_json,
+        NULLIF(current_setting('app.current_ip_address', TRUE), '')::INET
+    );
+
+    RETURN NULL;
+END;
+$$ language 'plpgsql';
+
+-- Inserted after the trigger is fixed, since the insert is itself audited
+INSERT INTO users (id, username, password, role)
+VALUES ('00000000-0000-0000-0000-000000000000', 'system', '!', 'customer')
+ON CONFLICT (id) DO NOTHING;
@@ -0,0 +1,13 @@
+-- migrations/000021_clearing_accounts.down.sql
+-- Postgres cannot drop the 'clearing' label, and removing the clearing
+-- accounts would unbalance the ledger, so they stay.
+DELETE FROM audit_logs WHERE action = 'deposit';
+
+ALTER TABLE audit_logs DROP CONSTRAINT IF EXISTS valid_action;
+ALTER TABLE audit_logs ADD CONSTRAINT valid_action CHECK (action IN (
+    'create', 'update', 'delete', 'suspend', 'activate',
+    'verify', 'login', 'logout', 'transfer', 'limit_change',
+    'access_denied', 'role_change'
+));
+
+DROP INDEX IF EXISTS idx_accounts_clearing_currency;
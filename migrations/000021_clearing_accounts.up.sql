@@ -0,0 +1,16 @@
+-- migrations/000021_clearing_accounts.up.sql
+-- Deposits credit accounts from a clearing account per currency, owned by
+-- the system user of 000020. The accounts are opened on first use; the new
+-- account_type label cannot be used in this transaction, so the index keys
+-- on the owner instead.
+ALTER TYPE account_type ADD VALUE IF NOT EXISTS 'clearing';
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_accounts_clearing_currency
+    ON accounts(currency) WHERE user_id = '00000000-0000-0000-0000-000000000000';
+
+ALTER TABLE audit_logs DROP CONSTRAINT IF EXISTS valid_action;
+ALTER TABLE audit_logs ADD CONSTRAINT valid_action CHECK (action IN (
+    'create', 'update', 'delete', 'suspend', 'activate',
+    'verify', 'login', 'logout', 'transfer', 'limit_change',
+    'access_denied', 'role_change', 'deposit'
+));
@@ -0,0 +1,2 @@
+-- migrations/000022_webhook_secret_backfill.down.sql
+-- The backfilled secrets stay, merchants may already verify with them
@@ -0,0 +1,15 @@
+-- migrations/000022_webhook_secret_backfill.up.sql
+-- Webhook signing secrets for existing merchants, which were signed with a
+-- shared fallback secret until now
+INSERT INTO webhook_secrets (id, merchant_id, secret, created_at)
+SELECT uuid_generate_v4()::text,
+       u.id::text,
+       'whsec_' || replace(uuid_generate_v4()::text || uuid_generate_v4()::text, '-', ''),
+       CURRENT_TIMESTAMP
+FROM users u
+WHERE (u.role = 'merchant' OR u.id::text IN (SELECT merchant_id FROM api_keys))
+  AND NOT EXISTS (
+      SELECT 1 FROM webhook_secrets s
+      WHERE s.merchant_id = u.id::text
+        AND (s.expires_at IS NULL OR s.expires_at > CURRENT_TIMESTAMP)
+  );
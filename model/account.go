@@ -1,16 +1,92 @@
 package model
 
-import "time"
+import (
+	"encoding/json"
+	"payment-server/money"
+	"time"
+)
+
+// Account statuses, mirroring the account_status enum
+const (
+	AccountActive              = "active"
+	AccountSuspended           = "suspended"
+	AccountClosed              = "closed"
+	AccountPendingVerification = "pending_verification"
+)
+
+// Account kinds, mirroring the account_type enum
+const (
+	AccountPersonal = "personal"
+	AccountBusiness = "business"
+	AccountSavings  = "savings"
+	AccountMerchant = "merchant"
+	// AccountClearing is the other side of deposits, one per currency. It is
+	// the only kind of account whose balance may go negative, and users
+	// cannot open one.
+	AccountClearing = "clearing"
+)
+
+// IsValidAccountStatus reports whether status is an account_status value
+func IsValidAccountStatus(status string) bool {
+	switch status {
+	case AccountActive, AccountSuspended, AccountClosed, AccountPendingVerification:
+		return true
+	}
+	return false
+}
+
+// IsValidAccountKind reports whether kind is an account_type value
+func IsValidAccountKind(kind string) bool {
+	switch kind {
+	case AccountPersonal, AccountBusiness, AccountSavings, AccountMerchant:
+		return true
+	}
+	return false
+}
 
 type Account struct {
-	ID       string `json:"id"`
-	Balance  int    `json:"balance"`
-	Status   string `json:"status"`
-	Kind     string `json:"kind"`
-	UserID   string `json:"user_id"`
-	Currency string `json:"currency"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID          string          `json:"id"`
+	Balance     money.Money     `json:"balance"`
+	Status      string          `json:"status"`
+	Kind        string          `json:"kind"`
+	UserID      string          `json:"user_id"`
+	Currency    string          `json:"currency"`
+	Name        string          `json:"name,omitempty"`
+	Description string          `json:"description,omitempty"`
+	Metadata    json.RawMessage `json:"metadata,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+
+	// Outgoing transfer totals in minor units, reset by the ledger when the UTC day or
+	// month of LastTransferDate has passed
+	DailyTransfersSum   int64      `json:"-"`
+	MonthlyTransfersSum int64      `json:"-"`
+	LastTransferDate    *time.Time `json:"-"`
 }
 
+// CreateAccountRequest opens an additional account for the current user
+type CreateAccountRequest struct {
+	Currency    string          `json:"currency"`
+	Kind        string          `json:"kind"`
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Metadata    json.RawMessage `json:"metadata"`
+}
+
+// UpdateAccountRequest changes the descriptive fields of an account. Fields
+// left out are kept; a null metadata clears it.
+type UpdateAccountRequest struct {
+	Name        *string         `json:"name"`
+	Description *string         `json:"description"`
+	Metadata    json.RawMessage `json:"metadata"`
+}
 
+type AccountResponse struct {
+	Success bool    `json:"success"`
+	Account Account `json:"account"`
+}
+
+type AccountsResponse struct {
+	Success  bool      `json:"success"`
+	Accounts []Account `json:"accounts"`
+}
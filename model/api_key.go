@@ -0,0 +1,59 @@
+package model
+
+import "time"
+
+// API key scopes
+const (
+	ScopePaymentsRead    = "payments:read"
+	ScopePaymentsWrite   = "payments:write"
+	ScopePaymentsConfirm = "payments:confirm"
+	ScopeWebhooksRead    = "webhooks:read"
+	ScopeWebhooksWrite   = "webhooks:write"
+)
+
+var scopes = map[string]bool{
+	ScopePaymentsRead:    true,
+	ScopePaymentsWrite:   true,
+	ScopePaymentsConfirm: true,
+	ScopeWebhooksRead:    true,
+	ScopeWebhooksWrite:   true,
+}
+
+// IsValidScope reports whether scope is a known API key scope
+func IsValidScope(scope string) bool {
+	return scopes[scope]
+}
+
+// APIKey authenticates a merchant's server against the payments API. Only a
+// hash of the key is stored; Key is filled in once, when the key is created.
+type APIKey struct {
+	ID         string     `json:"id"`
+	MerchantID string     `json:"merchant_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Key        string     `json:"key,omitempty"`
+	KeyHash    string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// HasScope reports whether the key grants scope
+func (k APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type APIKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+type APIKeysResponse struct {
+	Success bool     `json:"success"`
+	Keys    []APIKey `json:"keys"`
+}
@@ -0,0 +1,34 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Audit log actions written by the application. On Postgres, the audit
+// trigger also records every create, update and delete of users, accounts
+// and payments, attributed to SystemUserID outside a user session.
+const (
+	AuditAccessDenied = "access_denied"
+	AuditRoleChange   = "role_change"
+	AuditLimitChange  = "limit_change"
+	AuditDeposit      = "deposit"
+)
+
+// AuditLog is a row of audit_logs
+type AuditLog struct {
+	ID         string          `json:"id"`
+	EntityType string          `json:"entity_type"`
+	EntityID   string          `json:"entity_id"`
+	Action     string          `json:"action"`
+	ActorID    string          `json:"actor_id"`
+	ActorType  string          `json:"actor_type"`
+	Changes    json.RawMessage `json:"changes"`
+	IPAddress  string          `json:"ip_address,omitempty"`
+	UserAgent  string          `json:"user_agent,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+type RoleRequest struct {
+	Role string `json:"role"`
+}
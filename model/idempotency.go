@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+// IdempotencyRecord remembers the response to a request sent with an
+// Idempotency-Key so that retries can be replayed instead of re-executed.
+type IdempotencyRecord struct {
+	ClientID    string
+	Key         string
+	Fingerprint string
+	// StatusCode is zero while the original request is still being processed
+	StatusCode int
+	Body       []byte
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+}
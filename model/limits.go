@@ -0,0 +1,41 @@
+package model
+
+import (
+	"payment-server/money"
+	"time"
+)
+
+// AccountLimits caps the outgoing transfers and the balance of every
+// account of one kind and currency. It is a row of account_limits.
+type AccountLimits struct {
+	ID                   string       `json:"id"`
+	AccountType          string       `json:"account_type"`
+	Currency             string       `json:"currency"`
+	SingleTransferLimit  money.Money  `json:"single_transfer_limit"`
+	DailyTransferLimit   money.Money  `json:"daily_transfer_limit"`
+	MonthlyTransferLimit money.Money  `json:"monthly_transfer_limit"`
+	MinBalance           money.Money  `json:"min_balance"`
+	MaxBalance           *money.Money `json:"max_balance,omitempty"`
+	CreatedAt            time.Time    `json:"created_at"`
+	UpdatedAt            time.Time    `json:"updated_at"`
+}
+
+type AccountLimitsRequest struct {
+	SingleTransferLimit  money.Money  `json:"single_transfer_limit"`
+	DailyTransferLimit   money.Money  `json:"daily_transfer_limit"`
+	MonthlyTransferLimit money.Money  `json:"monthly_transfer_limit"`
+	MinBalance           money.Money  `json:"min_balance"`
+	MaxBalance           *money.Money `json:"max_balance"`
+}
+
+type AccountLimitsResponse struct {
+	Success bool            `json:"success"`
+	Limits  []AccountLimits `json:"limits"`
+}
+
+// ErrorResponse is an error with a machine readable code
+type ErrorResponse struct {
+	Success bool   `json:"success"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
@@ -0,0 +1,64 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrTransactionNotFound = errors.New("transaction not found")
+	// ErrStatusConflict means the transaction left the expected status
+	// before the update landed, typically because a concurrent request won.
+	ErrStatusConflict = errors.New("transaction status was changed concurrently")
+)
+
+// transitions lists, for every status, the statuses it may move to.
+// Statuses without an entry are terminal.
+var transitions = map[string][]string{
+	StatusPending:    {StatusProcessing, StatusSuccess, StatusError, StatusCancelled, StatusExpired},
+	StatusProcessing: {StatusSuccess, StatusError, StatusExpired},
+	StatusSuccess:    {StatusRefunded},
+}
+
+// TransitionError is returned when a status change is not allowed
+type TransitionError struct {
+	From string
+	To   string
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("transaction cannot move from %s to %s", e.From, e.To)
+}
+
+// IsValidStatus reports whether status is a known transaction status
+func IsValidStatus(status string) bool {
+	switch status {
+	case StatusPending, StatusProcessing, StatusSuccess, StatusError,
+		StatusCancelled, StatusExpired, StatusRefunded:
+		return true
+	}
+	return false
+}
+
+// CanTransition reports whether a transaction may move from one status to another
+func CanTransition(from, to string) bool {
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateTransition returns a *TransitionError when from -> to is not allowed
+func ValidateTransition(from, to string) error {
+	if !IsValidStatus(to) || !CanTransition(from, to) {
+		return &TransitionError{From: from, To: to}
+	}
+	return nil
+}
+
+// IsTerminal reports whether no further transition is possible from status
+func IsTerminal(status string) bool {
+	return len(transitions[status]) == 0
+}
@@ -1,17 +1,19 @@
 package model
 
 import (
+	"payment-server/money"
 	"time"
 )
 
 type TransactionRequest struct {
-	Amount       float64      `json:"amount"`
-	Currency     string       `json:"currency"`
+	Amount       money.Money  `json:"amount"`
 	PayerPhone   string       `json:"payer_phone"`
 	Description  string       `json:"description,omitempty"`
 	Reference    string       `json:"reference,omitempty"`
 	WebhookURL   string       `json:"webhook_url,omitempty"`
 	CallbackURLs CallbackURLs `json:"callback_urls,omitempty"`
+	// Provider picks the mobile money provider instead of routing by phone
+	Provider string `json:"provider,omitempty"`
 }
 
 type CallbackURLs struct {
@@ -20,19 +22,32 @@ type CallbackURLs struct {
 }
 
 type Transaction struct {
-	ID              string    `json:"id"`
-	Amount          float64   `json:"amount"`
-	Currency        string    `json:"currency"`
-	Status          string    `json:"status"`
-	PayerPhone      string    `json:"payer_phone"`
-	Description     string    `json:"description,omitempty"`
-	Reference       string    `json:"reference,omitempty"`
-	CreatedAt       time.Time `json:"created_at"`
-	UpdatedAt       time.Time `json:"updated_at"`
-	ExpiresAt       time.Time `json:"expires_at"`
-	WebhookURL      string    `json:"webhook_url,omitempty"`
-	CallbackSuccess string    `json:"callback_success,omitempty"`
-	CallbackError   string    `json:"callback_error,omitempty"`
+	ID              string      `json:"id"`
+	MerchantID      string      `json:"merchant_id,omitempty"`
+	Amount          money.Money `json:"amount"`
+	Status          string      `json:"status"`
+	PayerPhone      string      `json:"payer_phone"`
+	Description     string      `json:"description,omitempty"`
+	Reference       string      `json:"reference,omitempty"`
+	CreatedAt       time.Time   `json:"created_at"`
+	UpdatedAt       time.Time   `json:"updated_at"`
+	ExpiresAt       time.Time   `json:"expires_at"`
+	WebhookURL      string      `json:"webhook_url,omitempty"`
+	CallbackSuccess string      `json:"callback_success,omitempty"`
+	CallbackError   string      `json:"callback_error,omitempty"`
+	// CancellationReason is set when the transaction is cancelled
+	CancellationReason string `json:"cancellation_reason,omitempty"`
+	// Provider collects the payment under ProviderReference
+	Provider          string `json:"provider,omitempty"`
+	ProviderReference string `json:"provider_reference,omitempty"`
+	// StatusQueries counts the reconciler's status queries to the provider;
+	// the next one is due at NextStatusQueryAt
+	StatusQueries     int        `json:"-"`
+	NextStatusQueryAt *time.Time `json:"-"`
+}
+
+type CancelRequest struct {
+	Reason string `json:"reason"`
 }
 
 type TransactionResponse struct {
@@ -42,9 +57,20 @@ type TransactionResponse struct {
 	PaymentURL  string      `json:"payment_url,omitempty"`
 }
 
+// ProviderCallbackResponse acknowledges a provider callback without
+// exposing the transaction to the provider
+type ProviderCallbackResponse struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+	Status  string `json:"status"`
+}
+
 const (
-	StatusPending   = "pending"
-	StatusSuccess   = "success"
-	StatusError     = "error"
-	StatusCancelled = "cancelled"
-)
\ No newline at end of file
+	StatusPending    = "pending"
+	StatusProcessing = "processing"
+	StatusSuccess    = "success"
+	StatusError      = "error"
+	StatusCancelled  = "cancelled"
+	StatusExpired    = "expired"
+	StatusRefunded   = "refunded"
+)
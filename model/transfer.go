@@ -0,0 +1,54 @@
+package model
+
+import (
+	"payment-server/money"
+	"time"
+)
+
+// Payment statuses, mirroring the payment_status enum of the payments table
+const (
+	TransferPending    = "pending"
+	TransferProcessing = "processing"
+	TransferCompleted  = "completed"
+	TransferFailed     = "failed"
+	TransferRejected   = "rejected"
+	TransferRefunded   = "refunded"
+	TransferCancelled  = "cancelled"
+)
+
+// Transfer moves funds between two accounts of the same currency. It is a
+// row of the payments table.
+type Transfer struct {
+	ID            string      `json:"id"`
+	FromAccountID string      `json:"from_account_id"`
+	ToAccountID   string      `json:"to_account_id"`
+	Amount        money.Money `json:"amount"`
+	Status        string      `json:"status"`
+	Description   string      `json:"description,omitempty"`
+	Reference     string      `json:"reference,omitempty"`
+	ExecutedAt    *time.Time  `json:"executed_at,omitempty"`
+	CreatedAt     time.Time   `json:"created_at"`
+	UpdatedAt     time.Time   `json:"updated_at"`
+}
+
+type TransferRequest struct {
+	FromAccountID string      `json:"from_account_id"`
+	ToAccountID   string      `json:"to_account_id"`
+	Amount        money.Money `json:"amount"`
+	Description   string      `json:"description"`
+	Reference     string      `json:"reference"`
+}
+
+// DepositRequest credits an account from the clearing account of its
+// currency
+type DepositRequest struct {
+	Amount      money.Money `json:"amount"`
+	Description string      `json:"description"`
+	Reference   string      `json:"reference"`
+}
+
+type TransferResponse struct {
+	Success  bool     `json:"success"`
+	Message  string   `json:"message,omitempty"`
+	Transfer Transfer `json:"transfer"`
+}
@@ -2,11 +2,51 @@ package model
 
 import "time"
 
+// User roles
+const (
+	RoleCustomer = "customer"
+	RoleMerchant = "merchant"
+	RoleOperator = "operator"
+	RoleAdmin    = "admin"
+)
+
+// SystemUserID owns the clearing accounts. It cannot log in.
+const SystemUserID = "00000000-0000-0000-0000-000000000000"
+
+// IsValidRole reports whether role is one of the user roles
+func IsValidRole(role string) bool {
+	switch role {
+	case RoleCustomer, RoleMerchant, RoleOperator, RoleAdmin:
+		return true
+	}
+	return false
+}
+
 type User struct {
 	ID       string `json:"id"`
 	Username string `json:"username"`
 	Password string `json:"password"`
+	Role     string `json:"role"`
 	Accounts []Account `json:"accounts"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
+
+// RefreshToken is a stored refresh token. Only the hash of the token is
+// kept; each refresh replaces the token with a new one in the same family.
+type RefreshToken struct {
+	ID         string     `json:"id"`
+	UserID     string     `json:"user_id"`
+	TokenHash  string     `json:"-"`
+	FamilyID   string     `json:"family_id"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	ReplacedBy string     `json:"replaced_by,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// Active reports whether the token can still be exchanged at now
+func (t RefreshToken) Active(now time.Time) bool {
+	return t.RevokedAt == nil && now.Before(t.ExpiresAt)
+}
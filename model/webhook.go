@@ -0,0 +1,131 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	EventPaymentUpdated = "payment.updated"
+
+	WebhookPending   = "pending"
+	WebhookDelivered = "delivered"
+	// WebhookDead marks an event that exhausted its delivery attempts
+	WebhookDead = "dead"
+)
+
+// WebhookEvent is an outbox entry written together with the status change
+// that produced it and delivered later by the webhook dispatcher.
+type WebhookEvent struct {
+	ID            string           `json:"id"`
+	MerchantID    string           `json:"merchant_id,omitempty"`
+	TransactionID string           `json:"transaction_id"`
+	EventType     string           `json:"event_type"`
+	URL           string           `json:"url"`
+	Payload       json.RawMessage  `json:"payload"`
+	Status        string           `json:"status"`
+	Attempts      int              `json:"attempts"`
+	NextAttemptAt time.Time        `json:"next_attempt_at"`
+	LastError     string           `json:"last_error,omitempty"`
+	CreatedAt     time.Time        `json:"created_at"`
+	UpdatedAt     time.Time        `json:"updated_at"`
+	DeliveredAt   *time.Time       `json:"delivered_at,omitempty"`
+	Deliveries    []WebhookAttempt `json:"deliveries,omitempty"`
+}
+
+// WebhookAttempt logs one delivery attempt of a WebhookEvent
+type WebhookAttempt struct {
+	EventID         string    `json:"event_id"`
+	Attempt         int       `json:"attempt"`
+	StatusCode      int       `json:"status_code,omitempty"`
+	LatencyMS       int64     `json:"latency_ms"`
+	ResponseSnippet string    `json:"response_snippet,omitempty"`
+	Error           string    `json:"error,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// Succeeded reports whether the receiver acknowledged the event
+func (a WebhookAttempt) Succeeded() bool {
+	return a.Error == "" && a.StatusCode >= 200 && a.StatusCode < 300
+}
+
+// WebhookPayload is the JSON body posted to the merchant
+type WebhookPayload struct {
+	ID        string      `json:"id"`
+	EventType string      `json:"event_type"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      Transaction `json:"data"`
+}
+
+// WebhookSecret signs the webhooks of one merchant. A rotated secret keeps
+// signing until ExpiresAt so receivers can switch over without downtime.
+type WebhookSecret struct {
+	ID         string     `json:"id"`
+	MerchantID string     `json:"merchant_id"`
+	Secret     string     `json:"secret,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+}
+
+// Redacted hides all but the last characters of the secret
+func (s WebhookSecret) Redacted() WebhookSecret {
+	if len(s.Secret) > 4 {
+		s.Secret = "..." + s.Secret[len(s.Secret)-4:]
+	}
+	return s
+}
+
+// CallbackHost is a host that a merchant allows in the callback_urls of
+// its payments
+type CallbackHost struct {
+	MerchantID string    `json:"merchant_id"`
+	Host       string    `json:"host"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type CallbackHostRequest struct {
+	Host string `json:"host"`
+}
+
+type CallbackHostsResponse struct {
+	Success bool           `json:"success"`
+	Hosts   []CallbackHost `json:"hosts"`
+}
+
+type WebhookSecretsResponse struct {
+	Success bool            `json:"success"`
+	Secrets []WebhookSecret `json:"secrets"`
+}
+
+type WebhookEventsResponse struct {
+	Success bool           `json:"success"`
+	Events  []WebhookEvent `json:"events"`
+}
+
+// NewPaymentUpdatedEvent snapshots transaction into a payment.updated
+// outbox event that is due immediately
+func NewPaymentUpdatedEvent(id string, transaction Transaction) (*WebhookEvent, error) {
+	now := time.Now()
+	payload, err := json.Marshal(WebhookPayload{
+		ID:        id,
+		EventType: EventPaymentUpdated,
+		CreatedAt: now,
+		Data:      transaction,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &WebhookEvent{
+		ID:            id,
+		MerchantID:    transaction.MerchantID,
+		TransactionID: transaction.ID,
+		EventType:     EventPaymentUpdated,
+		URL:           transaction.WebhookURL,
+		Payload:       payload,
+		Status:        WebhookPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}, nil
+}
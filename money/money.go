@@ -0,0 +1,202 @@
+// Package money represents amounts as an integer number of minor units of
+// an ISO 4217 currency, so that no amount ever goes through floating point.
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"payment-server/currency"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrUnknownCurrency  = errors.New("money: unknown currency")
+	ErrCurrencyMismatch = errors.New("money: currencies differ")
+	ErrOverflow         = errors.New("money: amount out of range")
+	ErrInvalidAmount    = errors.New("money: invalid amount")
+	ErrPrecision        = errors.New("money: amount has more decimals than the currency allows")
+)
+
+// Exponent returns the number of decimals of the currency with code
+func Exponent(code string) (int, bool) {
+	c, ok := currency.Lookup(code)
+	return c.Exponent, ok
+}
+
+// Money is Amount minor units of Currency. In JSON it is an object whose
+// value is a decimal string: {"value": "12.50", "currency": "USD"}.
+type Money struct {
+	Amount   int64
+	Currency string
+}
+
+// New returns amount minor units of currency
+func New(amount int64, currency string) (Money, error) {
+	if _, ok := Exponent(currency); !ok {
+		return Money{}, fmt.Errorf("%w %q", ErrUnknownCurrency, currency)
+	}
+	return Money{Amount: amount, Currency: currency}, nil
+}
+
+// Parse reads a decimal string such as "-12.50" in currency. It fails
+// rather than round when s has more decimals than the currency.
+func Parse(s, currency string) (Money, error) {
+	exp, ok := Exponent(currency)
+	if !ok {
+		return Money{}, fmt.Errorf("%w %q", ErrUnknownCurrency, currency)
+	}
+
+	negative := strings.HasPrefix(s, "-")
+	whole, frac, _ := strings.Cut(strings.TrimPrefix(s, "-"), ".")
+	if whole == "" || strings.HasSuffix(s, ".") || !isDigits(whole) || !isDigits(frac) {
+		return Money{}, fmt.Errorf("%w %q", ErrInvalidAmount, s)
+	}
+	if trimmed := strings.TrimRight(frac, "0"); len(trimmed) > exp {
+		return Money{}, fmt.Errorf("%w: %q in %s", ErrPrecision, s, currency)
+	}
+	frac += strings.Repeat("0", exp)
+
+	amount, err := strconv.ParseInt(whole+frac[:exp], 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("%w: %q", ErrOverflow, s)
+	}
+	if negative {
+		amount = -amount
+	}
+	return Money{Amount: amount, Currency: currency}, nil
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Add returns m + other
+func (m Money) Add(other Money) (Money, error) {
+	if m.Currency != other.Currency {
+		return Money{}, ErrCurrencyMismatch
+	}
+	if (other.Amount > 0 && m.Amount > math.MaxInt64-other.Amount) ||
+		(other.Amount < 0 && m.Amount < math.MinInt64-other.Amount) {
+		return Money{}, ErrOverflow
+	}
+	return Money{Amount: m.Amount + other.Amount, Currency: m.Currency}, nil
+}
+
+// Sub returns m - other
+func (m Money) Sub(other Money) (Money, error) {
+	negated, err := other.Neg()
+	if err != nil {
+		return Money{}, err
+	}
+	return m.Add(negated)
+}
+
+// Neg returns -m
+func (m Money) Neg() (Money, error) {
+	if m.Amount == math.MinInt64 {
+		return Money{}, ErrOverflow
+	}
+	return Money{Amount: -m.Amount, Currency: m.Currency}, nil
+}
+
+// Mul returns m multiplied by n
+func (m Money) Mul(n int64) (Money, error) {
+	if m.Amount == 0 || n == 0 {
+		return Money{Currency: m.Currency}, nil
+	}
+	product := m.Amount * n
+	if product/n != m.Amount || (m.Amount == -1 && n == math.MinInt64) || (n == -1 && m.Amount == math.MinInt64) {
+		return Money{}, ErrOverflow
+	}
+	return Money{Amount: product, Currency: m.Currency}, nil
+}
+
+// Cmp compares m and other, which must be in the same currency
+func (m Money) Cmp(other Money) (int, error) {
+	if m.Currency != other.Currency {
+		return 0, ErrCurrencyMismatch
+	}
+	switch {
+	case m.Amount < other.Amount:
+		return -1, nil
+	case m.Amount > other.Amount:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func (m Money) IsZero() bool     { return m.Amount == 0 }
+func (m Money) IsPositive() bool { return m.Amount > 0 }
+func (m Money) IsNegative() bool { return m.Amount < 0 }
+
+// Decimal formats m with the decimals of its currency, e.g. "12.50"
+func (m Money) Decimal() string {
+	exp, _ := Exponent(m.Currency)
+
+	// Format the magnitude as unsigned so that MinInt64 survives
+	magnitude := uint64(m.Amount)
+	sign := ""
+	if m.Amount < 0 {
+		magnitude = -magnitude
+		sign = "-"
+	}
+	digits := strconv.FormatUint(magnitude, 10)
+	if exp == 0 {
+		return sign + digits
+	}
+	if len(digits) <= exp {
+		digits = strings.Repeat("0", exp-len(digits)+1) + digits
+	}
+	return sign + digits[:len(digits)-exp] + "." + digits[len(digits)-exp:]
+}
+
+// String formats m for people and logs, e.g. "12.50 USD"
+func (m Money) String() string {
+	return m.Decimal() + " " + m.Currency
+}
+
+type moneyJSON struct {
+	Value    json.RawMessage `json:"value"`
+	Currency string          `json:"currency"`
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	value, err := json.Marshal(m.Decimal())
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(moneyJSON{Value: value, Currency: m.Currency})
+}
+
+// UnmarshalJSON accepts the value as a decimal string or, for older
+// clients, a JSON number; either way it is parsed without floating point
+func (m *Money) UnmarshalJSON(data []byte) error {
+	var raw moneyJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if len(raw.Value) == 0 || string(raw.Value) == "null" {
+		return fmt.Errorf("%w: value is required", ErrInvalidAmount)
+	}
+
+	value := string(raw.Value)
+	if raw.Value[0] == '"' {
+		if err := json.Unmarshal(raw.Value, &value); err != nil {
+			return err
+		}
+	}
+	parsed, err := Parse(value, raw.Currency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
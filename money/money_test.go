@@ -0,0 +1,190 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		s, currency string
+		want        int64
+	}{
+		{"12.50", "USD", 1250},
+		{"12.5", "USD", 1250},
+		{"12", "USD", 1200},
+		{"-0.01", "USD", -1},
+		{"0.10", "USD", 10},
+		{"1000", "JPY", 1000},
+		// Trailing zeros beyond the exponent add no precision
+		{"1000.00", "JPY", 1000},
+		{"1.2300", "EUR", 123},
+		{"92233720368547758.07", "USD", math.MaxInt64},
+		{"9223372036854775807", "JPY", math.MaxInt64},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.s, tt.currency)
+		if err != nil {
+			t.Errorf("Parse(%q, %s) = %v", tt.s, tt.currency, err)
+			continue
+		}
+		if got.Amount != tt.want || got.Currency != tt.currency {
+			t.Errorf("Parse(%q, %s) = %+v, want %d", tt.s, tt.currency, got, tt.want)
+		}
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	tests := []struct {
+		s, currency string
+		want        error
+	}{
+		{"12.505", "USD", ErrPrecision},
+		{"0.001", "EUR", ErrPrecision},
+		{"1.5", "JPY", ErrPrecision},
+		{"100.01", "XOF", ErrPrecision},
+		{"92233720368547758.08", "USD", ErrOverflow},
+		{"9223372036854775808", "JPY", ErrOverflow},
+		{"-9223372036854775809", "JPY", ErrOverflow},
+		{"99999999999999999999999", "USD", ErrOverflow},
+		{"", "USD", ErrInvalidAmount},
+		{"-", "USD", ErrInvalidAmount},
+		{".50", "USD", ErrInvalidAmount},
+		{"12.", "USD", ErrInvalidAmount},
+		{"1e3", "USD", ErrInvalidAmount},
+		{"+12", "USD", ErrInvalidAmount},
+		{"1,50", "USD", ErrInvalidAmount},
+		{"12.50", "XXX", ErrUnknownCurrency},
+	}
+	for _, tt := range tests {
+		if got, err := Parse(tt.s, tt.currency); !errors.Is(err, tt.want) {
+			t.Errorf("Parse(%q, %s) = %+v, %v; want %v", tt.s, tt.currency, got, err, tt.want)
+		}
+	}
+}
+
+func TestArithmeticOverflow(t *testing.T) {
+	usd := func(amount int64) Money { return Money{Amount: amount, Currency: "USD"} }
+
+	tests := []struct {
+		name string
+		op   func() (Money, error)
+	}{
+		{"MaxInt64 + 1", func() (Money, error) { return usd(math.MaxInt64).Add(usd(1)) }},
+		{"MinInt64 + -1", func() (Money, error) { return usd(math.MinInt64).Add(usd(-1)) }},
+		{"MinInt64 - 1", func() (Money, error) { return usd(math.MinInt64).Sub(usd(1)) }},
+		{"0 - MinInt64", func() (Money, error) { return usd(0).Sub(usd(math.MinInt64)) }},
+		{"MaxInt64 - -1", func() (Money, error) { return usd(math.MaxInt64).Sub(usd(-1)) }},
+		{"MaxInt64 * 2", func() (Money, error) { return usd(math.MaxInt64).Mul(2) }},
+		{"MinInt64 * -1", func() (Money, error) { return usd(math.MinInt64).Mul(-1) }},
+		{"-1 * MinInt64", func() (Money, error) { return usd(-1).Mul(math.MinInt64) }},
+		{"2^32 * 2^32", func() (Money, error) { return usd(1 << 32).Mul(1 << 32) }},
+		{"-MinInt64", func() (Money, error) { return usd(math.MinInt64).Neg() }},
+	}
+	for _, tt := range tests {
+		if got, err := tt.op(); !errors.Is(err, ErrOverflow) {
+			t.Errorf("%s = %+v, %v; want ErrOverflow", tt.name, got, err)
+		}
+	}
+
+	// The bounds themselves are reachable
+	if got, err := usd(math.MaxInt64 - 1).Add(usd(1)); err != nil || got.Amount != math.MaxInt64 {
+		t.Errorf("MaxInt64-1 + 1 = %+v, %v", got, err)
+	}
+	if got, err := usd(math.MinInt64 + 1).Sub(usd(1)); err != nil || got.Amount != math.MinInt64 {
+		t.Errorf("MinInt64+1 - 1 = %+v, %v", got, err)
+	}
+	if got, err := usd(-1).Mul(math.MaxInt64); err != nil || got.Amount != -math.MaxInt64 {
+		t.Errorf("-1 * MaxInt64 = %+v, %v", got, err)
+	}
+}
+
+func TestCurrencyMismatch(t *testing.T) {
+	usd := Money{Amount: 100, Currency: "USD"}
+	eur := Money{Amount: 100, Currency: "EUR"}
+	if _, err := usd.Add(eur); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("USD + EUR = %v, want ErrCurrencyMismatch", err)
+	}
+	if _, err := usd.Sub(eur); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("USD - EUR = %v, want ErrCurrencyMismatch", err)
+	}
+	if _, err := usd.Cmp(eur); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("Cmp(USD, EUR) = %v, want ErrCurrencyMismatch", err)
+	}
+}
+
+func TestDecimal(t *testing.T) {
+	tests := []struct {
+		m    Money
+		want string
+	}{
+		{Money{Amount: 1250, Currency: "USD"}, "12.50"},
+		{Money{Amount: 5, Currency: "USD"}, "0.05"},
+		{Money{Amount: -5, Currency: "USD"}, "-0.05"},
+		{Money{Amount: 0, Currency: "USD"}, "0.00"},
+		{Money{Amount: 1000, Currency: "JPY"}, "1000"},
+		{Money{Amount: math.MaxInt64, Currency: "USD"}, "92233720368547758.07"},
+		{Money{Amount: math.MinInt64, Currency: "USD"}, "-92233720368547758.08"},
+		{Money{Amount: math.MinInt64, Currency: "JPY"}, "-9223372036854775808"},
+	}
+	for _, tt := range tests {
+		if got := tt.m.Decimal(); got != tt.want {
+			t.Errorf("%d %s: Decimal() = %q, want %q", tt.m.Amount, tt.m.Currency, got, tt.want)
+		}
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	for _, m := range []Money{
+		{Amount: 1250, Currency: "USD"},
+		{Amount: -1, Currency: "EUR"},
+		{Amount: 0, Currency: "GBP"},
+		{Amount: 1000, Currency: "JPY"},
+		{Amount: math.MaxInt64, Currency: "USD"},
+		{Amount: math.MinInt64 + 1, Currency: "JPY"},
+	} {
+		data, err := json.Marshal(m)
+		if err != nil {
+			t.Fatalf("Marshal(%+v): %v", m, err)
+		}
+		var got Money
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Fatalf("Unmarshal(%s): %v", data, err)
+		}
+		if got != m {
+			t.Errorf("round trip of %+v through %s gave %+v", m, data, got)
+		}
+	}
+
+	data, _ := json.Marshal(Money{Amount: 1250, Currency: "USD"})
+	if string(data) != `{"value":"12.50","currency":"USD"}` {
+		t.Errorf("Marshal = %s", data)
+	}
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	var m Money
+	// Older clients send the value as a number, which is not read as a float
+	if err := json.Unmarshal([]byte(`{"value": 12.34, "currency": "USD"}`), &m); err != nil || m.Amount != 1234 {
+		t.Errorf("Unmarshal of a numeric value = %+v, %v; want 1234", m, err)
+	}
+
+	rejected := map[string]error{
+		`{"currency": "USD"}`:                      ErrInvalidAmount,
+		`{"value": null, "currency": "USD"}`:       ErrInvalidAmount,
+		`{"value": "1.005", "currency": "USD"}`:    ErrPrecision,
+		`{"value": 1.5, "currency": "JPY"}`:        ErrPrecision,
+		`{"value": "1e2", "currency": "USD"}`:      ErrInvalidAmount,
+		`{"value": 1e2, "currency": "USD"}`:        ErrInvalidAmount,
+		`{"value": "12.00", "currency": "ABC"}`:    ErrUnknownCurrency,
+		`{"value": "1e400000", "currency": "EUR"}`: ErrInvalidAmount,
+	}
+	for data, want := range rejected {
+		var m Money
+		if err := json.Unmarshal([]byte(data), &m); !errors.Is(err, want) {
+			t.Errorf("Unmarshal(%s) = %v, want %v", data, err, want)
+		}
+	}
+}
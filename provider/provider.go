@@ -0,0 +1,146 @@
+// Package provider connects payments to the mobile money operators that
+// collect them. Each operator is an adapter implementing Provider; the
+// Registry picks one for a payer phone number.
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"payment-server/money"
+	"sort"
+	"strings"
+)
+
+var (
+	ErrUnknownProvider  = errors.New("provider: unknown provider")
+	ErrNoRoute          = errors.New("provider: no provider serves this phone number")
+	ErrUnknownReference = errors.New("provider: unknown collection reference")
+	ErrNotRefundable    = errors.New("provider: collection cannot be refunded")
+	// ErrInvalidSignature rejects a callback that the provider did not sign
+	ErrInvalidSignature = errors.New("provider: invalid callback signature")
+)
+
+// Collection asks the payer to pay Amount from their mobile money wallet
+type Collection struct {
+	TransactionID string
+	Amount        money.Money
+	PayerPhone    string
+	Description   string
+}
+
+// Result is the provider's view of a collection or refund. Status is one
+// of the model transaction statuses, already mapped from the provider's
+// own vocabulary.
+type Result struct {
+	Reference string
+	Status    string
+	Message   string
+}
+
+// Callback is a status update pushed by the provider
+type Callback struct {
+	TransactionID string
+	Reference     string
+	Status        string
+}
+
+// Provider is a mobile money operator adapter
+type Provider interface {
+	// Code identifies the provider in routes, requests and callback URLs
+	Code() string
+	// InitiateCollection starts collecting c; the result usually stays
+	// pending until the payer approves on their phone
+	InitiateCollection(ctx context.Context, c Collection) (*Result, error)
+	QueryStatus(ctx context.Context, reference string) (*Result, error)
+	// HandleCallback verifies the signature of a status update pushed to the
+	// callback endpoint and parses it
+	HandleCallback(ctx context.Context, header http.Header, body []byte) (*Callback, error)
+	Refund(ctx context.Context, reference string, amount money.Money) (*Result, error)
+}
+
+type route struct {
+	prefix string
+	code   string
+}
+
+// Registry holds the providers by code and the phone prefixes they serve
+type Registry struct {
+	providers map[string]Provider
+	routes    []route
+	fallback  string
+}
+
+func NewRegistry() *Registry {
+	return &Registry{providers: make(map[string]Provider)}
+}
+
+// Register adds p, replacing any provider with the same code
+func (r *Registry) Register(p Provider) {
+	r.providers[p.Code()] = p
+}
+
+func (r *Registry) Get(code string) (Provider, bool) {
+	p, ok := r.providers[code]
+	return p, ok
+}
+
+// Route sends payer phones starting with prefix, such as "+221", to the
+// provider code. The longest matching prefix wins.
+func (r *Registry) Route(prefix, code string) error {
+	if _, ok := r.providers[code]; !ok {
+		return fmt.Errorf("%w %q", ErrUnknownProvider, code)
+	}
+	r.routes = append(r.routes, route{prefix: NormalizePhone(prefix), code: code})
+	sort.SliceStable(r.routes, func(i, j int) bool {
+		return len(r.routes[i].prefix) > len(r.routes[j].prefix)
+	})
+	return nil
+}
+
+// SetDefault sends phones that match no route to the provider code
+func (r *Registry) SetDefault(code string) error {
+	if _, ok := r.providers[code]; !ok {
+		return fmt.Errorf("%w %q", ErrUnknownProvider, code)
+	}
+	r.fallback = code
+	return nil
+}
+
+// Resolve returns the provider named by code or, when code is empty, the
+// one routed for phone
+func (r *Registry) Resolve(code, phone string) (Provider, error) {
+	if code != "" {
+		p, ok := r.providers[code]
+		if !ok {
+			return nil, fmt.Errorf("%w %q", ErrUnknownProvider, code)
+		}
+		return p, nil
+	}
+
+	phone = NormalizePhone(phone)
+	for _, rt := range r.routes {
+		if strings.HasPrefix(phone, rt.prefix) {
+			return r.providers[rt.code], nil
+		}
+	}
+	if r.fallback != "" {
+		return r.providers[r.fallback], nil
+	}
+	return nil, ErrNoRoute
+}
+
+// NormalizePhone strips separators and turns a leading 00 into +
+func NormalizePhone(phone string) string {
+	phone = strings.Map(func(c rune) rune {
+		if c == ' ' || c == '-' || c == '.' || c == '(' || c == ')' {
+			return -1
+		}
+		return c
+	}, phone)
+	if strings.HasPrefix(phone, "00") {
+		phone = "+" + phone[2:]
+	}
+	return phone
+}
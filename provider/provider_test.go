@@ -0,0 +1,162 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"payment-server/model"
+	"payment-server/money"
+	"payment-server/webhook"
+	"testing"
+	"time"
+)
+
+// stubProvider only has a code, enough to be routed to
+type stubProvider struct {
+	Provider
+	code string
+}
+
+func (p stubProvider) Code() string { return p.code }
+
+func newTestRegistry(t *testing.T, fallback string) *Registry {
+	t.Helper()
+	r := NewRegistry()
+	for _, code := range []string{"orange", "orange_sn", "wave", "mtn"} {
+		r.Register(stubProvider{code: code})
+	}
+	routes := []struct{ prefix, code string }{
+		{"+221", "orange"},
+		{"+22177", "orange_sn"},
+		{"00 221 70", "wave"},
+		{"+233", "mtn"},
+	}
+	for _, rt := range routes {
+		if err := r.Route(rt.prefix, rt.code); err != nil {
+			t.Fatalf("Route(%q, %s): %v", rt.prefix, rt.code, err)
+		}
+	}
+	if fallback != "" {
+		if err := r.SetDefault(fallback); err != nil {
+			t.Fatalf("SetDefault(%s): %v", fallback, err)
+		}
+	}
+	return r
+}
+
+func TestResolveLongestPrefix(t *testing.T) {
+	r := newTestRegistry(t, "")
+
+	tests := []struct {
+		code, phone, want string
+	}{
+		{"", "+221761234567", "orange"},
+		{"", "+221771234567", "orange_sn"},
+		{"", "+221 70 123 45 67", "wave"},
+		{"", "00221771234567", "orange_sn"},
+		{"", "+233-24-123-4567", "mtn"},
+		// An explicit provider overrides the routes
+		{"mtn", "+221771234567", "mtn"},
+	}
+	for _, tt := range tests {
+		p, err := r.Resolve(tt.code, tt.phone)
+		if err != nil {
+			t.Errorf("Resolve(%q, %q) = %v", tt.code, tt.phone, err)
+			continue
+		}
+		if p.Code() != tt.want {
+			t.Errorf("Resolve(%q, %q) = %s, want %s", tt.code, tt.phone, p.Code(), tt.want)
+		}
+	}
+
+	if _, err := r.Resolve("", "+254712345678"); !errors.Is(err, ErrNoRoute) {
+		t.Errorf("Resolve of an unrouted phone = %v, want ErrNoRoute", err)
+	}
+	if _, err := r.Resolve("nope", "+221771234567"); !errors.Is(err, ErrUnknownProvider) {
+		t.Errorf("Resolve of an unknown code = %v, want ErrUnknownProvider", err)
+	}
+	if err := r.Route("+254", "nope"); !errors.Is(err, ErrUnknownProvider) {
+		t.Errorf("Route to an unknown code = %v, want ErrUnknownProvider", err)
+	}
+}
+
+func TestResolveFallback(t *testing.T) {
+	r := newTestRegistry(t, "mtn")
+
+	p, err := r.Resolve("", "+254712345678")
+	if err != nil || p.Code() != "mtn" {
+		t.Fatalf("Resolve of an unrouted phone = %v, %v; want the fallback mtn", p, err)
+	}
+	// Routes still win over the fallback
+	if p, err := r.Resolve("", "+221771234567"); err != nil || p.Code() != "orange_sn" {
+		t.Fatalf("Resolve of a routed phone = %v, %v; want orange_sn", p, err)
+	}
+	if err := r.SetDefault("nope"); !errors.Is(err, ErrUnknownProvider) {
+		t.Fatalf("SetDefault to an unknown code = %v, want ErrUnknownProvider", err)
+	}
+}
+
+func TestSimulatorOutcomes(t *testing.T) {
+	ctx := context.Background()
+	s := NewSimulator("sim_secret")
+
+	tests := []struct {
+		phone, want string
+	}{
+		{"+221770000001", model.StatusError},
+		{"+221770000002", model.StatusPending},
+		{"+221770000003", model.StatusSuccess},
+		{"+221770000000", model.StatusSuccess},
+	}
+	for i, tt := range tests {
+		c := Collection{
+			TransactionID: "tx_" + tt.phone,
+			Amount:        money.Money{Amount: 1000 + int64(i), Currency: "XOF"},
+			PayerPhone:    tt.phone,
+		}
+		initiated, err := s.InitiateCollection(ctx, c)
+		if err != nil || initiated.Status != model.StatusPending {
+			t.Fatalf("InitiateCollection(%s) = %+v, %v; want pending", tt.phone, initiated, err)
+		}
+
+		// The outcome is settled on the first query and then stays put
+		for query := 0; query < 2; query++ {
+			result, err := s.QueryStatus(ctx, initiated.Reference)
+			if err != nil || result.Status != tt.want {
+				t.Fatalf("QueryStatus for %s = %+v, %v; want %s", tt.phone, result, err, tt.want)
+			}
+		}
+
+		_, err = s.Refund(ctx, initiated.Reference, c.Amount)
+		if tt.want == model.StatusSuccess && err != nil {
+			t.Fatalf("Refund of a successful collection: %v", err)
+		}
+		if tt.want != model.StatusSuccess && !errors.Is(err, ErrNotRefundable) {
+			t.Fatalf("Refund of a %s collection = %v, want ErrNotRefundable", tt.want, err)
+		}
+	}
+
+	if _, err := s.QueryStatus(ctx, "SIM-unknown"); !errors.Is(err, ErrUnknownReference) {
+		t.Fatalf("QueryStatus of an unknown reference = %v, want ErrUnknownReference", err)
+	}
+}
+
+func TestSimulatorCallback(t *testing.T) {
+	s := NewSimulator("sim_secret")
+	body := []byte(`{"reference":"SIM-tx_1","transaction_id":"tx_1","status":"SUCCESSFUL"}`)
+
+	header := http.Header{}
+	header.Set(SimulatorSignatureHeader, webhook.Sign(body, time.Now(), "sim_secret"))
+	callback, err := s.HandleCallback(context.Background(), header, body)
+	if err != nil {
+		t.Fatalf("HandleCallback: %v", err)
+	}
+	if callback.TransactionID != "tx_1" || callback.Reference != "SIM-tx_1" || callback.Status != model.StatusSuccess {
+		t.Fatalf("HandleCallback = %+v", callback)
+	}
+
+	header.Set(SimulatorSignatureHeader, webhook.Sign(body, time.Now(), "forged"))
+	if _, err := s.HandleCallback(context.Background(), header, body); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("HandleCallback with a forged signature = %v, want ErrInvalidSignature", err)
+	}
+}
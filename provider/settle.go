@@ -0,0 +1,43 @@
+package provider
+
+import (
+	"errors"
+	"payment-server/model"
+)
+
+// StatusStore is the part of database.Store needed to settle transactions
+type StatusStore interface {
+	GetTransactionByID(id string) (*model.Transaction, error)
+	UpdateTransactionStatus(id, from, to string) (*model.Transaction, error)
+}
+
+// Settle moves transaction to the status its provider reported, through the
+// same state machine and payment.updated webhook as a manual confirmation or
+// rejection. It reports whether the status changed: a status the transaction
+// already has, or a pending status, is a no-op so that duplicate callbacks
+// and repeated polls are harmless.
+func Settle(store StatusStore, transaction *model.Transaction, status string) (*model.Transaction, bool, error) {
+	for attempt := 0; ; attempt++ {
+		if transaction.Status == status || status == model.StatusPending {
+			return transaction, false, nil
+		}
+
+		updated, err := store.UpdateTransactionStatus(transaction.ID, transaction.Status, status)
+		if err == nil {
+			return updated, true, nil
+		}
+		if !errors.Is(err, model.ErrStatusConflict) || attempt > 0 {
+			return nil, false, err
+		}
+
+		// A duplicate callback or poll may have settled it concurrently
+		current, getErr := store.GetTransactionByID(transaction.ID)
+		if getErr != nil {
+			return nil, false, getErr
+		}
+		if current == nil {
+			return nil, false, model.ErrTransactionNotFound
+		}
+		transaction = current
+	}
+}
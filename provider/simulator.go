@@ -0,0 +1,149 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"payment-server/model"
+	"payment-server/money"
+	"payment-server/webhook"
+	"strings"
+	"sync"
+)
+
+// SimulatorCode is the code of the Simulator provider
+const SimulatorCode = "simulator"
+
+// SimulatorSignatureHeader signs simulator callbacks in the format of
+// webhook.SignatureHeader, keyed with the simulator's callback secret
+const SimulatorSignatureHeader = "X-Simulator-Signature"
+
+// Statuses in the simulator's own vocabulary, as an operator would send them
+const (
+	simulatorPending    = "PENDING"
+	simulatorSuccessful = "SUCCESSFUL"
+	simulatorFailed     = "FAILED"
+	simulatorRefunded   = "REFUNDED"
+)
+
+// Simulator is an in-process provider for local development and tests.
+// Its outcome depends only on the last digit of the payer phone:
+//
+//	1  the payer declines and the collection fails
+//	2  the payer never answers and the collection stays pending
+//	*  the collection succeeds
+type Simulator struct {
+	secret      string
+	mu          sync.Mutex
+	collections map[string]*simulatedCollection
+}
+
+type simulatedCollection struct {
+	Collection
+	status string
+}
+
+// NewSimulator returns a simulator whose callbacks are signed with secret
+func NewSimulator(secret string) *Simulator {
+	return &Simulator{secret: secret, collections: make(map[string]*simulatedCollection)}
+}
+
+func (s *Simulator) Code() string {
+	return SimulatorCode
+}
+
+func (s *Simulator) InitiateCollection(ctx context.Context, c Collection) (*Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reference := "SIM-" + c.TransactionID
+	if _, exists := s.collections[reference]; !exists {
+		s.collections[reference] = &simulatedCollection{Collection: c, status: simulatorPending}
+	}
+	return &Result{Reference: reference, Status: model.StatusPending}, nil
+}
+
+// QueryStatus settles the collection on first query according to the
+// payer phone
+func (s *Simulator) QueryStatus(ctx context.Context, reference string) (*Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	collection, ok := s.collections[reference]
+	if !ok {
+		return nil, ErrUnknownReference
+	}
+	if collection.status == simulatorPending {
+		switch {
+		case strings.HasSuffix(collection.PayerPhone, "1"):
+			collection.status = simulatorFailed
+		case strings.HasSuffix(collection.PayerPhone, "2"):
+		default:
+			collection.status = simulatorSuccessful
+		}
+	}
+	return s.result(reference, collection.status)
+}
+
+// simulatorCallback is the JSON body the simulator posts on status changes
+type simulatorCallback struct {
+	Reference     string `json:"reference"`
+	TransactionID string `json:"transaction_id"`
+	Status        string `json:"status"`
+}
+
+func (s *Simulator) HandleCallback(ctx context.Context, header http.Header, body []byte) (*Callback, error) {
+	if err := webhook.Verify(body, header.Get(SimulatorSignatureHeader), s.secret, webhook.DefaultTolerance); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+
+	var payload simulatorCallback
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("provider: invalid simulator callback: %w", err)
+	}
+	status, err := simulatorStatus(payload.Status)
+	if err != nil {
+		return nil, err
+	}
+	return &Callback{TransactionID: payload.TransactionID, Reference: payload.Reference, Status: status}, nil
+}
+
+// Refund returns the full amount of a successful collection
+func (s *Simulator) Refund(ctx context.Context, reference string, amount money.Money) (*Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	collection, ok := s.collections[reference]
+	if !ok {
+		return nil, ErrUnknownReference
+	}
+	if collection.status != simulatorSuccessful || amount != collection.Amount {
+		return nil, ErrNotRefundable
+	}
+	collection.status = simulatorRefunded
+	return s.result(reference, collection.status)
+}
+
+func (s *Simulator) result(reference, status string) (*Result, error) {
+	mapped, err := simulatorStatus(status)
+	if err != nil {
+		return nil, err
+	}
+	return &Result{Reference: reference, Status: mapped}, nil
+}
+
+// simulatorStatus maps the simulator's vocabulary onto transaction statuses
+func simulatorStatus(status string) (string, error) {
+	switch status {
+	case simulatorPending:
+		return model.StatusPending, nil
+	case simulatorSuccessful:
+		return model.StatusSuccess, nil
+	case simulatorFailed:
+		return model.StatusError, nil
+	case simulatorRefunded:
+		return model.StatusRefunded, nil
+	}
+	return "", fmt.Errorf("provider: unknown simulator status %q", status)
+}
@@ -0,0 +1,46 @@
+package utils
+
+import "github.com/google/uuid"
+
+// IDGenerator mints unique identifiers for new records
+type IDGenerator interface {
+	NewID() string
+}
+
+// UUIDv7Generator returns time-sortable UUIDv7 values with an optional
+// prefix. The 74 random bits keep IDs unique across processes and the
+// library's monotonic sequence keeps them ordered within one process.
+type UUIDv7Generator struct {
+	Prefix string
+}
+
+func (g UUIDv7Generator) NewID() string {
+	return g.Prefix + uuid.Must(uuid.NewV7()).String()
+}
+
+var (
+	transactionIDs IDGenerator = UUIDv7Generator{Prefix: "TRX_"}
+	entityIDs      IDGenerator = UUIDv7Generator{}
+)
+
+// SetTransactionIDGenerator replaces the generator behind
+// GenerateTransactionID. It must be called before the server starts.
+func SetTransactionIDGenerator(g IDGenerator) {
+	transactionIDs = g
+}
+
+// SetIDGenerator replaces the generator behind GenerateID. It must be
+// called before the server starts.
+func SetIDGenerator(g IDGenerator) {
+	entityIDs = g
+}
+
+// GenerateTransactionID returns a new payment transaction ID (TRX_<uuidv7>)
+func GenerateTransactionID() string {
+	return transactionIDs.NewID()
+}
+
+// GenerateID returns a new ID for UUID keyed rows such as users and accounts
+func GenerateID() string {
+	return entityIDs.NewID()
+}
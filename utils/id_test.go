@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestGenerateTransactionIDUniqueAcrossGoroutines(t *testing.T) {
+	const goroutines = 64
+	const perGoroutine = 1000
+
+	ids := make(chan string, goroutines*perGoroutine)
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < perGoroutine; j++ {
+				ids <- GenerateTransactionID()
+			}
+		}()
+	}
+	wg.Wait()
+	close(ids)
+
+	seen := make(map[string]bool, goroutines*perGoroutine)
+	for id := range ids {
+		if seen[id] {
+			t.Fatalf("duplicate transaction ID %s", id)
+		}
+		seen[id] = true
+	}
+	if len(seen) != goroutines*perGoroutine {
+		t.Fatalf("got %d IDs, want %d", len(seen), goroutines*perGoroutine)
+	}
+}
+
+func TestGenerateTransactionIDFormat(t *testing.T) {
+	id := GenerateTransactionID()
+	if !strings.HasPrefix(id, "TRX_") {
+		t.Fatalf("transaction ID %q does not start with TRX_", id)
+	}
+
+	parsed, err := uuid.Parse(strings.TrimPrefix(id, "TRX_"))
+	if err != nil {
+		t.Fatalf("transaction ID %q does not end with a UUID: %v", id, err)
+	}
+	if parsed.Version() != 7 {
+		t.Fatalf("transaction ID %q is UUID version %d, want 7", id, parsed.Version())
+	}
+}
+
+func TestGenerateIDOrderedOverTime(t *testing.T) {
+	previous := GenerateID()
+	for i := 0; i < 1000; i++ {
+		if i%100 == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		id := GenerateID()
+		if id <= previous {
+			t.Fatalf("ID %s sorts before the earlier %s", id, previous)
+		}
+		previous = id
+	}
+}
+
+func TestUUIDv7GeneratorTimestamp(t *testing.T) {
+	before := time.Now().Truncate(time.Millisecond)
+	id := UUIDv7Generator{Prefix: "X_"}.NewID()
+	after := time.Now()
+
+	parsed := uuid.MustParse(strings.TrimPrefix(id, "X_"))
+	sec, nsec := parsed.Time().UnixTime()
+	created := time.Unix(sec, nsec)
+	if created.Before(before) || created.After(after) {
+		t.Fatalf("ID %s was minted at %v, want between %v and %v", id, created, before, after)
+	}
+}
@@ -0,0 +1,45 @@
+package webhook
+
+import (
+	"net/url"
+	"time"
+)
+
+// Query parameters appended to the merchant's callback URL when the payer
+// is redirected after a payment. The signature has the format of
+// SignatureHeader and signs RedirectPayload with the merchant's secrets.
+const (
+	RedirectTransactionParam = "transaction_id"
+	RedirectStatusParam      = "status"
+	RedirectSignatureParam   = "signature"
+)
+
+// RedirectPayload is the message signed in a redirect
+func RedirectPayload(transactionID, status string) []byte {
+	return []byte(transactionID + "." + status)
+}
+
+// RedirectURL appends the transaction ID, its status and their signature
+// made at timestamp with every given secret to callbackURL, keeping any
+// query the merchant put in it
+func RedirectURL(callbackURL, transactionID, status string, timestamp time.Time, secrets ...string) (string, error) {
+	u, err := url.Parse(callbackURL)
+	if err != nil {
+		return "", err
+	}
+
+	query := u.Query()
+	query.Set(RedirectTransactionParam, transactionID)
+	query.Set(RedirectStatusParam, status)
+	query.Set(RedirectSignatureParam, Sign(RedirectPayload(transactionID, status), timestamp, secrets...))
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// VerifyRedirect checks the signature of the query parameters a callback
+// URL was opened with, as Verify does for webhook bodies. Merchants should
+// check it before trusting the status, which the payer could edit.
+func VerifyRedirect(query url.Values, secret string, tolerance time.Duration) error {
+	payload := RedirectPayload(query.Get(RedirectTransactionParam), query.Get(RedirectStatusParam))
+	return Verify(payload, query.Get(RedirectSignatureParam), secret, tolerance)
+}
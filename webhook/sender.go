@@ -0,0 +1,113 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"payment-server/model"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxResponseSnippet bounds how much of the receiver's reply is logged
+const maxResponseSnippet = 512
+
+// ErrNoSigningSecret is returned for a merchant without an active secret.
+// Every merchant is given one when it becomes a merchant.
+var ErrNoSigningSecret = errors.New("merchant has no active webhook signing secret")
+
+// SecretSource looks up the signing secrets of a merchant
+type SecretSource interface {
+	ListActiveWebhookSecrets(ctx context.Context, merchantID string, now time.Time) ([]model.WebhookSecret, error)
+}
+
+// Sender signs outbox events and posts them to merchant webhook URLs
+type Sender struct {
+	client  *http.Client
+	secrets SecretSource
+}
+
+func NewSender(timeout time.Duration, secrets SecretSource) *Sender {
+	return &Sender{
+		client:  &http.Client{Timeout: timeout},
+		secrets: secrets,
+	}
+}
+
+// NewSecret generates a random webhook signing secret
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Send delivers one attempt of event and reports how the receiver responded
+func (s *Sender) Send(ctx context.Context, event *model.WebhookEvent, attempt int) model.WebhookAttempt {
+	result := model.WebhookAttempt{
+		EventID:   event.ID,
+		Attempt:   attempt,
+		CreatedAt: time.Now(),
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, event.URL, bytes.NewReader(event.Payload))
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-ID", event.ID)
+	req.Header.Set("X-Webhook-Event", event.EventType)
+	req.Header.Set("X-Webhook-Attempt", strconv.Itoa(attempt))
+
+	// Signed per attempt so the timestamp reflects when it was sent
+	secrets, err := s.SigningSecrets(ctx, event.MerchantID)
+	if err != nil {
+		result.Error = fmt.Sprintf("failed to load signing secrets: %v", err)
+		return result
+	}
+	req.Header.Set(SignatureHeader, Sign(event.Payload, time.Now(), secrets...))
+
+	start := time.Now()
+	resp, err := s.client.Do(req)
+	result.LatencyMS = time.Since(start).Milliseconds()
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer resp.Body.Close()
+
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseSnippet))
+	result.StatusCode = resp.StatusCode
+	// The snippet ends up in a TEXT column, which rejects invalid UTF-8 and NUL
+	result.ResponseSnippet = strings.ReplaceAll(strings.ToValidUTF8(string(snippet), "\uFFFD"), "\x00", "")
+	return result
+}
+
+// SigningSecrets returns the active secrets of the merchant, or
+// ErrNoSigningSecret if it has none
+func (s *Sender) SigningSecrets(ctx context.Context, merchantID string) ([]string, error) {
+	if merchantID == "" {
+		return nil, ErrNoSigningSecret
+	}
+	active, err := s.secrets.ListActiveWebhookSecrets(ctx, merchantID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if len(active) == 0 {
+		return nil, ErrNoSigningSecret
+	}
+	secrets := make([]string, len(active))
+	for i, secret := range active {
+		secrets[i] = secret.Secret
+	}
+	return secrets, nil
+}
@@ -0,0 +1,86 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SignatureHeader carries the timestamped HMAC-SHA256 signatures of a
+// webhook body, formatted as "t=<unix seconds>,v1=<hex>[,v1=<hex>]". While a
+// secret is being rotated the body is signed with both active secrets.
+const SignatureHeader = "X-Webhook-Signature"
+
+// DefaultTolerance is the maximum age of a signature accepted by Verify
+// when the caller has no stricter requirement
+const DefaultTolerance = 5 * time.Minute
+
+var (
+	ErrInvalidSignatureHeader = errors.New("webhook: invalid signature header")
+	ErrSignatureMismatch      = errors.New("webhook: no signature matches the payload")
+	ErrSignatureExpired       = errors.New("webhook: signature timestamp is outside the tolerance")
+)
+
+// Sign returns the SignatureHeader value for payload signed at timestamp
+// with every given secret
+func Sign(payload []byte, timestamp time.Time, secrets ...string) string {
+	t := strconv.FormatInt(timestamp.Unix(), 10)
+	parts := []string{"t=" + t}
+	for _, secret := range secrets {
+		parts = append(parts, "v1="+computeSignature(payload, t, secret))
+	}
+	return strings.Join(parts, ",")
+}
+
+// Verify checks that header holds a signature of payload made with secret
+// no longer than tolerance ago. Receivers should call it with the raw
+// request body before decoding it.
+func Verify(payload []byte, header, secret string, tolerance time.Duration) error {
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return ErrInvalidSignatureHeader
+		}
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	if timestamp == "" || len(signatures) == 0 {
+		return ErrInvalidSignatureHeader
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: bad timestamp", ErrInvalidSignatureHeader)
+	}
+	age := time.Since(time.Unix(seconds, 0))
+	if age > tolerance || age < -tolerance {
+		return ErrSignatureExpired
+	}
+
+	expected := []byte(computeSignature(payload, timestamp, secret))
+	for _, signature := range signatures {
+		if hmac.Equal(expected, []byte(signature)) {
+			return nil
+		}
+	}
+	return ErrSignatureMismatch
+}
+
+func computeSignature(payload []byte, timestamp, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,101 @@
+package webhook
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	oldSecret = "whsec_old_0123456789abcdef0123456789abcdef"
+	newSecret = "whsec_new_0123456789abcdef0123456789abcdef"
+)
+
+var payload = []byte(`{"id":"evt_1","status":"success"}`)
+
+func TestVerifyAcceptsFreshSignature(t *testing.T) {
+	header := Sign(payload, time.Now(), newSecret)
+	if err := Verify(payload, header, newSecret, DefaultTolerance); err != nil {
+		t.Fatalf("Verify = %v, want nil", err)
+	}
+}
+
+func TestVerifyRejectsOutsideTolerance(t *testing.T) {
+	for _, offset := range []time.Duration{-DefaultTolerance - time.Minute, DefaultTolerance + time.Minute} {
+		header := Sign(payload, time.Now().Add(offset), newSecret)
+		if err := Verify(payload, header, newSecret, DefaultTolerance); !errors.Is(err, ErrSignatureExpired) {
+			t.Errorf("Verify of a signature made %v from now = %v, want ErrSignatureExpired", offset, err)
+		}
+	}
+}
+
+func TestVerifyRejectsTamperedBody(t *testing.T) {
+	header := Sign(payload, time.Now(), newSecret)
+	tampered := []byte(strings.Replace(string(payload), "success", "failed", 1))
+	if err := Verify(tampered, header, newSecret, DefaultTolerance); !errors.Is(err, ErrSignatureMismatch) {
+		t.Fatalf("Verify of a tampered body = %v, want ErrSignatureMismatch", err)
+	}
+	if err := Verify(payload, header, oldSecret, DefaultTolerance); !errors.Is(err, ErrSignatureMismatch) {
+		t.Fatalf("Verify with another secret = %v, want ErrSignatureMismatch", err)
+	}
+}
+
+func TestVerifyRejectsMalformedHeader(t *testing.T) {
+	signature := computeSignature(payload, "1700000000", newSecret)
+	headers := []string{
+		"",
+		"garbage",
+		"t=1700000000",
+		"v1=" + signature,
+		"t=soon,v1=" + signature,
+		"t=1700000000,v1",
+	}
+	for _, header := range headers {
+		if err := Verify(payload, header, newSecret, DefaultTolerance); !errors.Is(err, ErrInvalidSignatureHeader) {
+			t.Errorf("Verify(%q) = %v, want ErrInvalidSignatureHeader", header, err)
+		}
+	}
+}
+
+// During a rotation the body is signed with both secrets, and receivers
+// holding either one accept it
+func TestVerifyDuringRotation(t *testing.T) {
+	header := Sign(payload, time.Now(), oldSecret, newSecret)
+	if n := strings.Count(header, "v1="); n != 2 {
+		t.Fatalf("Sign with two secrets gave %d signatures: %s", n, header)
+	}
+	for _, secret := range []string{oldSecret, newSecret} {
+		if err := Verify(payload, header, secret, DefaultTolerance); err != nil {
+			t.Errorf("Verify with %s = %v, want nil", secret, err)
+		}
+	}
+	if err := Verify(payload, header, "whsec_unrelated", DefaultTolerance); !errors.Is(err, ErrSignatureMismatch) {
+		t.Errorf("Verify with an unrelated secret = %v, want ErrSignatureMismatch", err)
+	}
+}
+
+func TestVerifyRedirect(t *testing.T) {
+	redirectURL, err := RedirectURL("https://shop.example/return?order=42", "tx_1", "success", time.Now(), newSecret)
+	if err != nil {
+		t.Fatalf("RedirectURL: %v", err)
+	}
+	u, err := url.Parse(redirectURL)
+	if err != nil {
+		t.Fatalf("parse %s: %v", redirectURL, err)
+	}
+	query := u.Query()
+	if query.Get("order") != "42" {
+		t.Fatalf("RedirectURL dropped the merchant's query: %s", redirectURL)
+	}
+	if err := VerifyRedirect(query, newSecret, DefaultTolerance); err != nil {
+		t.Fatalf("VerifyRedirect = %v, want nil", err)
+	}
+
+	// The payer can edit the status in the address bar
+	query.Set(RedirectStatusParam, "failed")
+	if err := VerifyRedirect(query, newSecret, DefaultTolerance); !errors.Is(err, ErrSignatureMismatch) {
+		t.Fatalf("VerifyRedirect of an edited status = %v, want ErrSignatureMismatch", err)
+	}
+}
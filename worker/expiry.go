@@ -0,0 +1,72 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"payment-server/database"
+	"payment-server/model"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const expiryBatchSize = 100
+
+// ExpirySweeper moves pending and processing transactions past their
+// ExpiresAt to expired, so that a collection the provider never settles
+// does not stay open forever. The store queues the payment.updated webhook
+// with each status change.
+type ExpirySweeper struct {
+	runner
+	store database.Store
+}
+
+func NewExpirySweeper(store database.Store, interval time.Duration) *ExpirySweeper {
+	return &ExpirySweeper{
+		runner: runner{name: "expiry sweeper", interval: interval},
+		store:  store,
+	}
+}
+
+func (s *ExpirySweeper) Start() {
+	log.Info().Dur("interval", s.interval).Msg("Starting expiry sweeper")
+	s.start(func(ctx context.Context) {
+		if _, err := s.Sweep(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			log.Error().Err(err).Msg("Expiry sweep failed")
+		}
+	})
+}
+
+// Sweep expires every overdue pending or processing transaction and returns
+// how many were expired
+func (s *ExpirySweeper) Sweep(ctx context.Context) (int, error) {
+	expired := 0
+	for {
+		transactions, err := s.store.ListExpiredTransactions(ctx, time.Now(), expiryBatchSize)
+		if err != nil {
+			return expired, err
+		}
+
+		for _, transaction := range transactions {
+			if err := ctx.Err(); err != nil {
+				return expired, err
+			}
+
+			updated, err := s.store.UpdateTransactionStatus(transaction.ID, transaction.Status, model.StatusExpired)
+			if errors.Is(err, model.ErrStatusConflict) {
+				// Confirmed or cancelled while we were looking at it
+				continue
+			}
+			if err != nil {
+				return expired, err
+			}
+			expired++
+
+			log.Info().Str("transactionID", updated.ID).Msg("Transaction expired")
+		}
+
+		if len(transactions) < expiryBatchSize {
+			return expired, nil
+		}
+	}
+}
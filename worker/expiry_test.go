@@ -0,0 +1,64 @@
+package worker
+
+import (
+	"context"
+	"payment-server/database"
+	"payment-server/model"
+	"payment-server/money"
+	"payment-server/utils"
+	"testing"
+	"time"
+)
+
+func TestSweepExpiresUnsettledTransactions(t *testing.T) {
+	store := database.NewMemoryStore()
+	now := time.Now()
+
+	tests := []struct {
+		status    string
+		expiresAt time.Time
+		want      string
+	}{
+		{model.StatusPending, now.Add(-time.Minute), model.StatusExpired},
+		{model.StatusProcessing, now.Add(-time.Minute), model.StatusExpired},
+		{model.StatusPending, now.Add(time.Minute), model.StatusPending},
+		{model.StatusProcessing, now.Add(time.Minute), model.StatusProcessing},
+		{model.StatusSuccess, now.Add(-time.Minute), model.StatusSuccess},
+		{model.StatusCancelled, now.Add(-time.Minute), model.StatusCancelled},
+	}
+	ids := make([]string, len(tests))
+	for i, tt := range tests {
+		ids[i] = utils.GenerateID()
+		err := store.SaveTransaction(&model.Transaction{
+			ID:         ids[i],
+			MerchantID: "merchant",
+			Amount:     money.Money{Amount: 1000, Currency: "XOF"},
+			Status:     tt.status,
+			PayerPhone: "+221770000003",
+			CreatedAt:  now.Add(-time.Hour),
+			UpdatedAt:  now.Add(-time.Hour),
+			ExpiresAt:  tt.expiresAt,
+		})
+		if err != nil {
+			t.Fatalf("SaveTransaction: %v", err)
+		}
+	}
+
+	expired, err := NewExpirySweeper(store, time.Minute).Sweep(context.Background())
+	if err != nil {
+		t.Fatalf("Sweep: %v", err)
+	}
+	if expired != 2 {
+		t.Errorf("Sweep expired %d transactions, want 2", expired)
+	}
+	for i, tt := range tests {
+		transaction, err := store.GetTransactionByID(ids[i])
+		if err != nil || transaction == nil {
+			t.Fatalf("GetTransactionByID(%s) = %+v, %v", ids[i], transaction, err)
+		}
+		if transaction.Status != tt.want {
+			t.Errorf("%s transaction expiring at %s is %s after the sweep, want %s",
+				tt.status, tt.expiresAt.Format(time.TimeOnly), transaction.Status, tt.want)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"payment-server/config"
+	"payment-server/database"
+	"payment-server/metrics"
+	"payment-server/model"
+	"payment-server/provider"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const reconcileBatchSize = 50
+
+// Reconciler polls providers for payments whose callback has not arrived,
+// so that a lost callback does not leave a paid transaction pending until
+// it expires. Each transaction is queried with exponential backoff.
+type Reconciler struct {
+	runner
+	store          database.Store
+	providers      *provider.Registry
+	after          time.Duration
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+}
+
+func NewReconciler(store database.Store, providers *provider.Registry, cfg config.ProvidersConfig) *Reconciler {
+	return &Reconciler{
+		runner:         runner{name: "reconciler", interval: cfg.ReconcileInterval.Duration},
+		store:          store,
+		providers:      providers,
+		after:          cfg.ReconcileAfter.Duration,
+		initialBackoff: cfg.ReconcileInitialBackoff.Duration,
+		maxBackoff:     cfg.ReconcileMaxBackoff.Duration,
+	}
+}
+
+func (r *Reconciler) Start() {
+	log.Info().Dur("interval", r.interval).Dur("after", r.after).Msg("Starting reconciler")
+	r.start(func(ctx context.Context) {
+		if _, err := r.Reconcile(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			log.Error().Err(err).Msg("Reconciliation failed")
+		}
+	})
+}
+
+// Reconcile queries the provider of every transaction that is due and
+// returns how many were settled. A single batch is queried per call so
+// that a slow provider cannot hold up the next tick.
+func (r *Reconciler) Reconcile(ctx context.Context) (int, error) {
+	now := time.Now()
+	transactions, err := r.store.ListTransactionsToReconcile(ctx, now.Add(-r.after), now, reconcileBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	settled := 0
+	for i := range transactions {
+		if err := ctx.Err(); err != nil {
+			return settled, err
+		}
+		if r.reconcile(ctx, &transactions[i]) {
+			settled++
+		}
+	}
+	return settled, nil
+}
+
+// reconcile queries the provider of transaction and settles it, scheduling
+// the next query when it stays unsettled
+func (r *Reconciler) reconcile(ctx context.Context, transaction *model.Transaction) bool {
+	logger := log.With().Str("transactionID", transaction.ID).Str("provider", transaction.Provider).Logger()
+
+	collector, ok := r.providers.Get(transaction.Provider)
+	if !ok {
+		logger.Error().Msg("Transaction collected by an unknown provider")
+		r.schedule(ctx, transaction)
+		return false
+	}
+
+	result, err := collector.QueryStatus(ctx, transaction.ProviderReference)
+	if err != nil {
+		if ctx.Err() != nil {
+			return false
+		}
+		logger.Warn().Err(err).Int("queries", transaction.StatusQueries+1).Msg("Provider status query failed")
+		metrics.StatusQueries.WithLabelValues(transaction.Provider, "failed").Inc()
+		r.schedule(ctx, transaction)
+		return false
+	}
+
+	updated, changed, err := provider.Settle(r.store, transaction, result.Status)
+	if err != nil {
+		logger.Error().Err(err).Str("status", result.Status).Msg("Failed to apply provider status")
+		metrics.StatusQueries.WithLabelValues(transaction.Provider, "failed").Inc()
+		r.schedule(ctx, transaction)
+		return false
+	}
+
+	if updated.Status == model.StatusPending || updated.Status == model.StatusProcessing {
+		metrics.StatusQueries.WithLabelValues(transaction.Provider, "pending").Inc()
+		r.schedule(ctx, updated)
+		return false
+	}
+
+	metrics.StatusQueries.WithLabelValues(transaction.Provider, "settled").Inc()
+	if !changed {
+		// Settled by a callback since the transaction was listed
+		return false
+	}
+	metrics.PaymentsResolved.WithLabelValues(metrics.SourcePolling, updated.Status).Inc()
+	logger.Info().Str("status", updated.Status).Msg("Transaction settled by provider status query")
+	return true
+}
+
+func (r *Reconciler) schedule(ctx context.Context, transaction *model.Transaction) {
+	queries := transaction.StatusQueries + 1
+	next := time.Now().Add(backoff(queries, r.initialBackoff, r.maxBackoff))
+	if err := r.store.ScheduleStatusQuery(context.WithoutCancel(ctx), transaction.ID, queries, next); err != nil {
+		log.Error().Err(err).Str("transactionID", transaction.ID).Msg("Failed to schedule provider status query")
+	}
+}
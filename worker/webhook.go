@@ -0,0 +1,134 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"payment-server/config"
+	"payment-server/database"
+	"payment-server/model"
+	"payment-server/webhook"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+const webhookBatchSize = 20
+
+// WebhookDispatcher delivers outbox events, retrying failures with
+// exponential backoff and jitter until they succeed or are dead-lettered
+type WebhookDispatcher struct {
+	runner
+	store          database.Store
+	sender         *webhook.Sender
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	lease          time.Duration
+}
+
+func NewWebhookDispatcher(store database.Store, sender *webhook.Sender, cfg config.WebhooksConfig) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		runner:         runner{name: "webhook dispatcher", interval: cfg.DispatchInterval.Duration},
+		store:          store,
+		sender:         sender,
+		maxAttempts:    cfg.MaxAttempts,
+		initialBackoff: cfg.InitialBackoff.Duration,
+		maxBackoff:     cfg.MaxBackoff.Duration,
+		// Long enough for a delivery to time out before anyone reclaims it
+		lease: 2 * cfg.Timeout.Duration,
+	}
+}
+
+func (d *WebhookDispatcher) Start() {
+	log.Info().Dur("interval", d.interval).Msg("Starting webhook dispatcher")
+	d.start(func(ctx context.Context) {
+		if _, err := d.Dispatch(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			log.Error().Err(err).Msg("Webhook dispatch failed")
+		}
+	})
+}
+
+// Dispatch delivers every due event and returns how many attempts were made
+func (d *WebhookDispatcher) Dispatch(ctx context.Context) (int, error) {
+	attempted := 0
+	for {
+		events, err := d.store.ClaimDueWebhookEvents(ctx, time.Now(), d.lease, webhookBatchSize)
+		if err != nil {
+			return attempted, err
+		}
+
+		var wg sync.WaitGroup
+		for i := range events {
+			wg.Add(1)
+			go func(event *model.WebhookEvent) {
+				defer wg.Done()
+				d.deliver(ctx, event)
+			}(&events[i])
+		}
+		wg.Wait()
+		attempted += len(events)
+
+		if err := ctx.Err(); err != nil {
+			return attempted, err
+		}
+		if len(events) < webhookBatchSize {
+			return attempted, nil
+		}
+	}
+}
+
+func (d *WebhookDispatcher) deliver(ctx context.Context, event *model.WebhookEvent) {
+	attempt := d.sender.Send(ctx, event, event.Attempts+1)
+	if ctx.Err() != nil {
+		// Shutting down: leave the event leased so it is retried after restart
+		return
+	}
+
+	now := time.Now()
+	event.Attempts = attempt.Attempt
+	switch {
+	case attempt.Succeeded():
+		event.Status = model.WebhookDelivered
+		event.DeliveredAt = &now
+		event.LastError = ""
+	case event.Attempts >= d.maxAttempts:
+		event.Status = model.WebhookDead
+		event.LastError = attemptError(attempt)
+	default:
+		event.NextAttemptAt = now.Add(backoff(event.Attempts, d.initialBackoff, d.maxBackoff))
+		event.LastError = attemptError(attempt)
+	}
+
+	if err := d.store.RecordWebhookAttempt(context.WithoutCancel(ctx), event, &attempt); err != nil {
+		log.Error().Err(err).Str("eventID", event.ID).Msg("Failed to record webhook attempt")
+		return
+	}
+
+	var logEvent *zerolog.Event
+	switch {
+	case event.Status == model.WebhookDead:
+		logEvent = log.Error().Str("error", event.LastError)
+	case !attempt.Succeeded():
+		logEvent = log.Warn().Str("error", event.LastError)
+	default:
+		logEvent = log.Info()
+	}
+	logEvent.
+		Str("eventID", event.ID).
+		Str("transactionID", event.TransactionID).
+		Int("attempt", attempt.Attempt).
+		Int("statusCode", attempt.StatusCode).
+		Int64("latencyMs", attempt.LatencyMS).
+		Str("status", event.Status).
+		Msg("Webhook delivery attempted")
+}
+
+func attemptError(attempt model.WebhookAttempt) string {
+	if attempt.Error != "" {
+		return attempt.Error
+	}
+	return fmt.Sprintf("unexpected status code %d", attempt.StatusCode)
+}
@@ -0,0 +1,75 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"math/bits"
+	"math/rand"
+	"time"
+)
+
+// Worker is a background job started with the server and stopped during
+// graceful shutdown
+type Worker interface {
+	Start()
+	Stop(ctx context.Context) error
+}
+
+// runner calls a tick function once at start and then every interval
+// until stopped. Workers embed it to get Stop for free.
+type runner struct {
+	name     string
+	interval time.Duration
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+func (r *runner) start(tick func(ctx context.Context)) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	r.done = make(chan struct{})
+
+	go func() {
+		defer close(r.done)
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+
+		for {
+			tick(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop cancels the worker and waits for the current tick to finish
+func (r *runner) Stop(ctx context.Context) error {
+	if r.cancel == nil {
+		return nil
+	}
+	r.cancel()
+
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%s did not stop in time: %w", r.name, ctx.Err())
+	}
+}
+
+// backoff doubles the delay after every failed attempt, capped at max, and
+// randomizes the second half of it so that work failing together does not
+// retry in lockstep
+func backoff(attempts int, initial, max time.Duration) time.Duration {
+	delay := max
+	// initial << shift is at most max, so it cannot wrap around, as long as
+	// shift is below the bit length of max/initial
+	if shift := attempts - 1; initial > 0 && shift >= 0 && shift < bits.Len64(uint64(max/initial)) {
+		delay = initial << shift
+	}
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
@@ -0,0 +1,36 @@
+package worker
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts     int
+		initial, max time.Duration
+		want         time.Duration
+	}{
+		{1, 30 * time.Second, 6 * time.Hour, 30 * time.Second},
+		{2, 30 * time.Second, 6 * time.Hour, time.Minute},
+		{5, 30 * time.Second, 6 * time.Hour, 8 * time.Minute},
+		{10, 30 * time.Second, 6 * time.Hour, 512 * 30 * time.Second},
+		{11, 30 * time.Second, 6 * time.Hour, 6 * time.Hour},
+		{1000, 30 * time.Second, 6 * time.Hour, 6 * time.Hour},
+		{math.MaxInt, 30 * time.Second, 6 * time.Hour, 6 * time.Hour},
+		{23, 1 << 40, math.MaxInt64, 1 << 62},
+		// 2^40ns shifted by 31 would wrap around int64
+		{32, 1 << 40, math.MaxInt64, math.MaxInt64},
+		{1, time.Hour, time.Minute, time.Minute},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 100; i++ {
+			got := backoff(tt.attempts, tt.initial, tt.max)
+			if got < tt.want/2 || got > tt.want {
+				t.Fatalf("backoff(%d, %v, %v) = %v, want between %v and %v",
+					tt.attempts, tt.initial, tt.max, got, tt.want/2, tt.want)
+			}
+		}
+	}
+}